@@ -26,3 +26,9 @@ func (eng *engine) accept(fd int, filter netpoll.IOEvent, flags netpoll.IOFlags)
 func (el *eventloop) accept(fd int, filter netpoll.IOEvent, flags netpoll.IOFlags) error {
 	return el.accept1(fd, filter, flags)
 }
+
+// deregisterListener deletes the readable filter of listener, ModWrite of kqueue
+// deletes the readable filter while Delete is a no-op.
+func (el *eventloop) deregisterListener() error {
+	return el.poller.ModWrite(el.ln.pollAttachment)
+}
@@ -26,3 +26,7 @@ func (eng *engine) accept(fd int, ev netpoll.IOEvent) error {
 func (el *eventloop) accept(fd int, ev netpoll.IOEvent) error {
 	return el.accept1(fd, ev, 0)
 }
+
+func (el *eventloop) deregisterListener() error {
+	return el.poller.Delete(el.ln.fd)
+}
@@ -18,7 +18,8 @@
 package gnet
 
 import (
-	"time"
+	"net"
+	"sync/atomic"
 
 	"golang.org/x/sys/unix"
 
@@ -29,67 +30,297 @@ import (
 	"github.com/panjf2000/gnet/v2/pkg/logging"
 )
 
-func (eng *engine) accept1(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error {
+// acceptConn accepts a new connection from the listener fd and binds it to el, or the next event-loop
+// picked by the load balancer if el is nil. It returns unix.EAGAIN when there are no more connections
+// to accept and a nil conn without error if the connection is rejected or there is a retryable error.
+func (eng *engine) acceptConn(fd int, el *eventloop) (*conn, error) {
 	nfd, sa, err := socket.Accept(fd)
 	if err != nil {
 		switch err {
-		case unix.EINTR, unix.EAGAIN, unix.ECONNABORTED:
+		case unix.EAGAIN:
+			return nil, err
+		case unix.EINTR, unix.ECONNABORTED:
 			// ECONNABORTED means that a socket on the listen
 			// queue was closed before we Accept()ed it;
 			// it's a silly error, so try again.
-			return nil
+			return nil, nil
 		default:
 			eng.opts.Logger.Errorf("Accept() failed due to error: %v", err)
-			return errors.ErrAcceptSocket
+			return nil, errors.ErrAcceptSocket
 		}
 	}
 
+	if !eng.permit(socket.SockaddrToIP(sa)) {
+		_ = unix.Close(nfd)
+		eng.reject(socket.SockaddrToTCPOrUnixAddr(sa), RejectAccessDenied)
+		return nil, nil
+	}
+
 	remoteAddr := socket.SockaddrToTCPOrUnixAddr(sa)
-	if eng.opts.TCPKeepAlive > 0 && eng.ln.network == "tcp" {
-		err = socket.SetKeepAlivePeriod(nfd, int(eng.opts.TCPKeepAlive.Seconds()))
-		logging.Error(err)
+	if ua, ok := remoteAddr.(*net.UnixAddr); ok {
+		ua.Net = eng.ln.network
+	}
+	if !eng.admit(nfd, remoteAddr) {
+		return nil, nil
+	}
+	logging.Error(setConnSockOpts(nfd, eng.ln.network, eng.opts))
+	if control := eng.opts.ConnControl; control != nil {
+		var address string
+		if remoteAddr != nil {
+			address = remoteAddr.String()
+		}
+		if err = control(eng.ln.network, address, nfd); err != nil {
+			eng.opts.Logger.Warnf("connection from %s is closed by ConnControl: %v", address, err)
+			_ = unix.Close(nfd)
+			eng.admission.leave(remoteAddr)
+			return nil, nil
+		}
 	}
 
-	el := eng.eventLoops.next(remoteAddr)
+	if el == nil {
+		el = eng.eventLoops.next(remoteAddr)
+		atomic.AddInt32(&el.assigned, 1)
+	}
 	c := newTCPConn(nfd, el, sa, el.ln.addr, remoteAddr)
-	err = el.poller.Trigger(queue.HighPriority, el.register, c)
-	if err != nil {
-		eng.opts.Logger.Errorf("failed to enqueue accepted socket of high-priority: %v", err)
-		_ = unix.Close(nfd)
+	c.admitted = true
+	c.isPacket = eng.ln.network == "unixpacket"
+	c.proxyPending = eng.opts.ProxyProtocol != ProxyProtocolDisabled
+	return c, nil
+}
+
+func (eng *engine) accept1(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error {
+	if eng.opts.AcceptBatch <= 1 {
+		c, err := eng.acceptConn(fd, nil)
+		if c != nil {
+			eng.handOff(c.loop, c)
+		}
+		if err == unix.EAGAIN {
+			return nil
+		}
+		return err
+	}
+
+	// Accept connections until EAGAIN or the batch is full, then hand them off
+	// to each sub-reactor in a single task to amortize the cost of wake-ups.
+	var err error
+	conns := eng.accepted[:0]
+	for i := 0; i < eng.opts.AcceptBatch; i++ {
+		var c *conn
+		if c, err = eng.acceptConn(fd, nil); err != nil {
+			break
+		}
+		if c != nil {
+			conns = append(conns, c)
+		}
+	}
+	for i, c := range conns {
+		if c == nil {
+			continue // already handed off along with a previous connection
+		}
+		var batch []*conn
+		for j := i + 1; j < len(conns); j++ {
+			if conns[j] == nil || conns[j].loop != c.loop {
+				continue
+			}
+			if batch == nil {
+				batch = append(make([]*conn, 0, len(conns)-i), c)
+			}
+			batch = append(batch, conns[j])
+			conns[j] = nil
+		}
+		if batch == nil {
+			eng.handOff(c.loop, c)
+		} else {
+			eng.handOff(c.loop, batch)
+		}
+		conns[i] = nil
+	}
+	eng.accepted = conns[:0]
+	if err == unix.EAGAIN {
+		return nil
+	}
+	return err
+}
+
+// handOff enqueues either a connection or a batch of connections to the sub-reactor el.
+func (eng *engine) handOff(el *eventloop, itf interface{}) {
+	err := el.poller.Trigger(queue.HighPriority, el.registerAccepted, itf)
+	if err == nil {
+		return
+	}
+
+	eng.opts.Logger.Errorf("failed to enqueue accepted socket of high-priority: %v", err)
+	conns, ok := itf.([]*conn)
+	if !ok {
+		conns = []*conn{itf.(*conn)}
+	}
+	atomic.AddInt32(&el.assigned, -int32(len(conns)))
+	for _, c := range conns {
+		_ = unix.Close(c.fd)
+		if c.admitted {
+			eng.admission.leave(c.remoteAddr)
+		}
 		c.release()
 	}
-	return nil
+}
+
+// registerAccepted registers a connection or a batch of connections handed off by the main reactor,
+// each connection stops being counted as assigned once it's registered.
+func (el *eventloop) registerAccepted(itf interface{}) (err error) {
+	if c, ok := itf.(*conn); ok {
+		defer atomic.AddInt32(&el.assigned, -1)
+		return el.register(c)
+	}
+	for _, c := range itf.([]*conn) {
+		if e := el.register(c); e != nil && (err == nil || e == errors.ErrEngineShutdown) {
+			err = e
+		}
+		atomic.AddInt32(&el.assigned, -1)
+	}
+	return
+}
+
+// admit checks the new connection against the admission control of engine,
+// the connection is closed if it's rejected.
+func (eng *engine) admit(fd int, remoteAddr net.Addr) bool {
+	reason, ok := eng.admission.admit(remoteAddr)
+	if ok {
+		return true
+	}
+
+	if len(eng.opts.RejectPayload) > 0 {
+		_, _ = unix.Write(fd, eng.opts.RejectPayload)
+	}
+	_ = unix.Close(fd)
+	eng.reject(remoteAddr, reason)
+	return false
 }
 
 func (el *eventloop) accept1(fd int, ev netpoll.IOEvent, flags netpoll.IOFlags) error {
-	if el.ln.network == "udp" {
+	if el.ln.isDatagram() {
 		return el.readUDP1(fd, ev, flags)
 	}
 
-	nfd, sa, err := socket.Accept(el.ln.fd)
-	if err != nil {
-		switch err {
-		case unix.EINTR, unix.EAGAIN, unix.ECONNABORTED:
-			// ECONNABORTED means that a socket on the listen
-			// queue was closed before we Accept()ed it;
-			// it's a silly error, so try again.
+	batch := el.engine.opts.AcceptBatch
+	if batch < 1 {
+		batch = 1
+	}
+	for i := 0; i < batch; i++ {
+		c, err := el.engine.acceptConn(el.ln.fd, el)
+		if err == unix.EAGAIN {
 			return nil
-		default:
-			el.getLogger().Errorf("Accept() failed due to error: %v", err)
-			return errors.ErrAcceptSocket
+		}
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			continue
+		}
+
+		if err = el.pollConn(c); err != nil {
+			_ = unix.Close(c.fd)
+			if c.admitted {
+				el.engine.admission.leave(c.remoteAddr)
+			}
+			c.release()
+			return err
+		}
+		el.connections.addConn(c, el.idx)
+		if err = el.open(c); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	remoteAddr := socket.SockaddrToTCPOrUnixAddr(sa)
-	if el.engine.opts.TCPKeepAlive > 0 && el.ln.network == "tcp" {
-		err = socket.SetKeepAlivePeriod(nfd, int(el.engine.opts.TCPKeepAlive/time.Second))
-		logging.Error(err)
+// iterateAcceptors calls f on the event-loops that accept connections, either the main reactor
+// or each event-loop with its own listener.
+func (eng *engine) iterateAcceptors(f func(el *eventloop)) {
+	if eng.acceptor != nil {
+		f(eng.acceptor)
+		return
 	}
+	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		f(el)
+		return true
+	})
+}
 
-	c := newTCPConn(nfd, el, sa, el.ln.addr, remoteAddr)
-	if err = el.poller.AddRead(&c.pollAttachment); err != nil {
+// pauseAccept removes the listeners from the pollers, it must be called with acceptMu held.
+func (eng *engine) pauseAccept() {
+	if eng.acceptPaused {
+		return
+	}
+	eng.acceptPaused = true
+	eng.iterateAcceptors(func(el *eventloop) {
+		if err := el.poller.Trigger(queue.HighPriority, el.stopAccept, nil); err != nil {
+			eng.opts.Logger.Errorf("failed to stop accepting in event-loop(%d): %v", el.idx, err)
+		}
+	})
+}
+
+// resumeAccept adds the listeners back to the pollers, it must be called with acceptMu held.
+func (eng *engine) resumeAccept() {
+	if !eng.acceptPaused {
+		return
+	}
+	eng.acceptPaused = false
+	eng.iterateAcceptors(func(el *eventloop) {
+		if err := el.poller.Trigger(queue.HighPriority, el.startAccept, nil); err != nil {
+			eng.opts.Logger.Errorf("failed to resume accepting in event-loop(%d): %v", el.idx, err)
+		}
+	})
+}
+
+// PauseAccept stops accepting new connections without closing the listener, the incoming
+// connections are queued up in the backlog of listener till ResumeAccept is called, the
+// existing connections are not affected.
+//
+// It takes effect asynchronously on the event-loops and is not supported by UDP and unixgram.
+func (e Engine) PauseAccept() error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if e.eng.ln.isDatagram() {
+		return errors.ErrUnsupportedOp
+	}
+
+	e.eng.acceptMu.Lock()
+	defer e.eng.acceptMu.Unlock()
+	e.eng.pauseAccept()
+	return nil
+}
+
+// ResumeAccept resumes accepting new connections after PauseAccept.
+//
+// It takes effect asynchronously on the event-loops and is not supported by UDP and unixgram.
+func (e Engine) ResumeAccept() error {
+	if err := e.Validate(); err != nil {
 		return err
 	}
-	el.connections.addConn(c, el.idx)
-	return el.open(c)
+	if e.eng.ln.isDatagram() {
+		return errors.ErrUnsupportedOp
+	}
+
+	e.eng.acceptMu.Lock()
+	defer e.eng.acceptMu.Unlock()
+	if e.eng.isDraining() {
+		return errors.ErrEngineInShutdown
+	}
+	e.eng.resumeAccept()
+	return nil
+}
+
+func (el *eventloop) stopAccept(_ interface{}) error {
+	if err := el.deregisterListener(); err != nil {
+		el.getLogger().Errorf("failed to deregister listener in event-loop(%d): %v", el.idx, err)
+	}
+	return nil
+}
+
+func (el *eventloop) startAccept(_ interface{}) error {
+	if err := el.poller.AddRead(el.ln.pollAttachment); err != nil {
+		el.getLogger().Errorf("failed to register listener in event-loop(%d): %v", el.idx, err)
+	}
+	return nil
 }
@@ -19,6 +19,7 @@ import (
 	"net"
 	"runtime"
 	"sync/atomic"
+	"syscall"
 
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 )
@@ -50,6 +51,9 @@ func (eng *engine) listen() (err error) {
 				return
 			}
 
+			if !eng.permit(addrIP(addr)) {
+				continue // drop the packet from the denied source
+			}
 			el := eng.eventLoops.next(addr)
 			c := newUDPConn(el, eng.ln.addr, addr)
 			el.ch <- packUDPConn(c, buffer[:n])
@@ -67,8 +71,33 @@ func (eng *engine) listen() (err error) {
 				}
 				return
 			}
+			if eng.isDraining() {
+				_ = tc.Close()
+				continue
+			}
+			if !eng.permit(addrIP(tc.RemoteAddr())) {
+				_ = tc.Close()
+				eng.reject(tc.RemoteAddr(), RejectAccessDenied)
+				continue
+			}
+			if reason, ok := eng.admission.admit(tc.RemoteAddr()); !ok {
+				if len(eng.opts.RejectPayload) > 0 {
+					_, _ = tc.Write(eng.opts.RejectPayload)
+				}
+				_ = tc.Close()
+				eng.reject(tc.RemoteAddr(), reason)
+				continue
+			}
+			if e = eng.controlConn(tc); e != nil {
+				eng.opts.Logger.Warnf("connection from %s is closed by ConnControl: %v", tc.RemoteAddr(), e)
+				_ = tc.Close()
+				eng.admission.leave(tc.RemoteAddr())
+				continue
+			}
 			el := eng.eventLoops.next(tc.RemoteAddr())
 			c := newTCPConn(tc, el)
+			c.admitted = true
+			c.proxyPending = eng.opts.ProxyProtocol != ProxyProtocolDisabled
 			el.ch <- &openConn{c: c}
 			go func(c *conn, tc net.Conn, el *eventloop) {
 				var buffer [0x10000]byte
@@ -84,3 +113,35 @@ func (eng *engine) listen() (err error) {
 		}
 	}
 }
+
+// controlConn calls ConnControl on the raw handle of the accepted connection.
+func (eng *engine) controlConn(c net.Conn) (err error) {
+	control := eng.opts.ConnControl
+	if control == nil {
+		return nil
+	}
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return errorx.ErrUnsupportedOp
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	if e := rc.Control(func(fd uintptr) {
+		err = control(eng.ln.network, c.RemoteAddr().String(), int(fd))
+	}); e != nil {
+		return e
+	}
+	return
+}
+
+// PauseAccept is not supported on Windows.
+func (e Engine) PauseAccept() error {
+	return errorx.ErrUnsupportedOp
+}
+
+// ResumeAccept is not supported on Windows.
+func (e Engine) ResumeAccept() error {
+	return errorx.ErrUnsupportedOp
+}
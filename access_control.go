@@ -0,0 +1,121 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"fmt"
+	"net"
+)
+
+// accessControl filters the source IPs of new connections and UDP packets,
+// it's immutable once created so that it can be swapped atomically.
+type accessControl struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// parseCIDRs parses a list of CIDR notations, a bare IP is treated as a single-host network.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %v", s, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// newAccessControl returns nil if both the allow and deny lists are empty.
+func newAccessControl(allow, deny []string) (*accessControl, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	ac := new(accessControl)
+	var err error
+	if ac.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if ac.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return ac, nil
+}
+
+// addrIP returns the IP of the address, or nil if it's not an IP address.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// permit reports whether the given IP is allowed, a deny entry takes precedence over an allow entry
+// and a non-empty allow list rejects every IP that is not in it. A nil accessControl or a nil IP,
+// e.g. the peer of a unix socket, is always permitted.
+func (ac *accessControl) permit(ip net.IP) bool {
+	if ac == nil || ip == nil {
+		return true
+	}
+	if containsIP(ac.deny, ip) {
+		return false
+	}
+	return len(ac.allow) == 0 || containsIP(ac.allow, ip)
+}
+
+// permit checks the given IP against the current access control of engine.
+func (eng *engine) permit(ip net.IP) bool {
+	ac, _ := eng.acl.Load().(*accessControl)
+	return ac.permit(ip)
+}
+
+// UpdateAccessControl replaces the allow and deny lists of source IPs in CIDR notation
+// with the given ones, it takes effect on subsequent connections and UDP packets,
+// the established connections are not affected. Passing two empty lists disables
+// the access control.
+func (e Engine) UpdateAccessControl(allow, deny []string) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	ac, err := newAccessControl(allow, deny)
+	if err != nil {
+		return err
+	}
+	e.eng.acl.Store(ac)
+	return nil
+}
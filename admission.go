@@ -0,0 +1,177 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// RejectReason is the reason why a new connection is rejected by the engine.
+type RejectReason int
+
+const (
+	// RejectMaxConnections indicates that the number of active connections reaches Options.MaxConnections.
+	RejectMaxConnections RejectReason = iota + 1
+
+	// RejectMaxConnectionsPerIP indicates that the number of active connections from the same
+	// source IP reaches Options.MaxConnectionsPerIP.
+	RejectMaxConnectionsPerIP
+
+	// RejectAcceptRate indicates that new connections arrive faster than Options.AcceptRate.
+	RejectAcceptRate
+
+	// RejectAccessDenied indicates that the source IP is denied by the access control,
+	// see Options.AllowedCIDRs and Options.DeniedCIDRs.
+	RejectAccessDenied
+)
+
+// String returns the description of the reject reason.
+func (r RejectReason) String() string {
+	switch r {
+	case RejectMaxConnections:
+		return "too many connections"
+	case RejectMaxConnectionsPerIP:
+		return "too many connections from the same IP"
+	case RejectAcceptRate:
+		return "accept rate exceeded"
+	case RejectAccessDenied:
+		return "access denied"
+	default:
+		return "unknown"
+	}
+}
+
+// tokenBucket is a token-bucket rate limiter, it's not goroutine-safe.
+type tokenBucket struct {
+	rate   float64 // tokens generated per second
+	burst  float64 // capacity of the bucket
+	tokens float64 // available tokens
+	last   time.Time
+}
+
+func (tb *tokenBucket) take(now time.Time) bool {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// admission controls whether a new connection is allowed to be accepted by the engine.
+type admission struct {
+	mu       sync.Mutex
+	maxConns int
+	maxPerIP int
+	conns    int
+	perIP    map[string]int
+	limiter  *tokenBucket
+}
+
+// newAdmission returns nil if none of the admission options is set up.
+func newAdmission(opts *Options) *admission {
+	if opts.MaxConnections <= 0 && opts.MaxConnectionsPerIP <= 0 && opts.AcceptRate <= 0 {
+		return nil
+	}
+	ad := &admission{maxConns: opts.MaxConnections, maxPerIP: opts.MaxConnectionsPerIP}
+	if ad.maxPerIP > 0 {
+		ad.perIP = make(map[string]int)
+	}
+	if opts.AcceptRate > 0 {
+		burst := opts.AcceptBurst
+		if burst <= 0 {
+			burst = opts.AcceptRate
+		}
+		ad.limiter = &tokenBucket{
+			rate:   float64(opts.AcceptRate),
+			burst:  float64(burst),
+			tokens: float64(burst),
+			last:   time.Now(),
+		}
+	}
+	return ad
+}
+
+// sourceIP returns the IP of the remote address, or an empty string if it's not an IP address.
+func sourceIP(addr net.Addr) string {
+	if ip := addrIP(addr); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// admit reports whether the connection from addr is admitted, the connection that is admitted
+// must be paired with a call to leave when it's closed. A nil admission admits everything.
+func (ad *admission) admit(addr net.Addr) (RejectReason, bool) {
+	if ad == nil {
+		return 0, true
+	}
+
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	if ad.maxConns > 0 && ad.conns >= ad.maxConns {
+		return RejectMaxConnections, false
+	}
+	var ip string
+	if ad.maxPerIP > 0 {
+		if ip = sourceIP(addr); ip != "" && ad.perIP[ip] >= ad.maxPerIP {
+			return RejectMaxConnectionsPerIP, false
+		}
+	}
+	if ad.limiter != nil && !ad.limiter.take(time.Now()) {
+		return RejectAcceptRate, false
+	}
+
+	ad.conns++
+	if ip != "" {
+		ad.perIP[ip]++
+	}
+	return 0, true
+}
+
+// leave releases the quota taken by the connection from addr.
+func (ad *admission) leave(addr net.Addr) {
+	if ad == nil {
+		return
+	}
+
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	ad.conns--
+	if ad.maxPerIP > 0 {
+		if ip := sourceIP(addr); ip != "" {
+			if n := ad.perIP[ip] - 1; n > 0 {
+				ad.perIP[ip] = n
+			} else {
+				delete(ad.perIP, ip)
+			}
+		}
+	}
+}
+
+// reject notifies the event handler of the rejected connection if it implements RejectHandler.
+func (eng *engine) reject(remoteAddr net.Addr, reason RejectReason) {
+	if h, ok := eng.eventHandler.(RejectHandler); ok {
+		h.OnReject(remoteAddr, reason)
+	}
+}
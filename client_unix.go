@@ -43,9 +43,13 @@ type Client struct {
 	el   *eventloop
 }
 
-// NewClient creates an instance of Client.
+// NewClient creates an instance of Client, it fails with errors.ErrUnsupportedOp if any of
+// the Linux-specific socket options is set on the other platforms.
 func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 	options := loadOptions(opts...)
+	if err = checkSockOpts(options); err != nil {
+		return
+	}
 	cli = new(Client)
 	cli.opts = options
 
@@ -85,6 +89,7 @@ func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 		ln:     eng.ln,
 		engine: &eng,
 		poller: p,
+		alloc:  newLoopAllocator(options),
 	}
 
 	rbc := options.ReadBufferCap
@@ -110,6 +115,9 @@ func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 	el.connections.init()
 	el.eventHandler = eh
 	cli.el = &el
+	// Register the event-loop for the engine-wide accounting, e.g. the memory limit.
+	eng.eventLoops = new(roundRobinLoadBalancer)
+	eng.eventLoops.register(cli.el)
 	return
 }
 
@@ -193,6 +201,10 @@ func (cli *Client) EnrollContext(c net.Conn, ctx interface{}) (Conn, error) {
 		}
 	}
 
+	if err = setConnSockOpts(dupFD, c.LocalAddr().Network(), cli.opts); err != nil {
+		return nil, err
+	}
+
 	var (
 		sockAddr unix.Sockaddr
 		gc       *conn
@@ -202,20 +214,20 @@ func (cli *Client) EnrollContext(c net.Conn, ctx interface{}) (Conn, error) {
 		if sockAddr, _, _, err = socket.GetUnixSockAddr(c.RemoteAddr().Network(), c.RemoteAddr().String()); err != nil {
 			return nil, err
 		}
+		if c.RemoteAddr().Network() == "unixgram" {
+			gc = newUDPConn(dupFD, cli.el, c.LocalAddr(), sockAddr, true)
+			break
+		}
 		ua := c.LocalAddr().(*net.UnixAddr)
 		ua.Name = c.RemoteAddr().String() + "." + strconv.Itoa(dupFD)
 		gc = newTCPConn(dupFD, cli.el, sockAddr, c.LocalAddr(), c.RemoteAddr())
+		gc.isPacket = c.RemoteAddr().Network() == "unixpacket"
 	case *net.TCPConn:
 		if cli.opts.TCPNoDelay == TCPDelay {
 			if err = socket.SetNoDelay(dupFD, 0); err != nil {
 				return nil, err
 			}
 		}
-		if cli.opts.TCPKeepAlive > 0 {
-			if err = socket.SetKeepAlivePeriod(dupFD, int(cli.opts.TCPKeepAlive.Seconds())); err != nil {
-				return nil, err
-			}
-		}
 		if sockAddr, _, _, _, err = socket.GetTCPSockAddr(c.RemoteAddr().Network(), c.RemoteAddr().String()); err != nil {
 			return nil, err
 		}
@@ -34,6 +34,9 @@ type Client struct {
 
 func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 	options := loadOptions(opts...)
+	if err = checkSockOpts(options); err != nil {
+		return
+	}
 	cli = &Client{opts: options}
 
 	logger, logFlusher := logging.GetDefaultLogger(), logging.GetDefaultFlusher()
@@ -64,6 +67,7 @@ func NewClient(eh EventHandler, opts ...Option) (cli *Client, err error) {
 		ch:           make(chan interface{}, 1024),
 		eng:          eng,
 		connections:  make(map[*conn]struct{}),
+		alloc:        newLoopAllocator(options),
 		eventHandler: eh,
 	}
 	return
@@ -0,0 +1,43 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"io"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// closeError is the error passed to OnClose, it matches the sentinel error of the reason with errors.Is
+// and unwraps to the underlying error that caused the connection to be closed.
+type closeError struct {
+	reason error
+	err    error
+}
+
+func (e *closeError) Error() string {
+	return e.reason.Error() + ": " + e.err.Error()
+}
+
+func (e *closeError) Is(target error) bool {
+	return target == e.reason
+}
+
+func (e *closeError) Unwrap() error {
+	return e.err
+}
+
+// errPeerClosed is passed to OnClose when the peer shuts down the connection gracefully.
+var errPeerClosed error = &closeError{errorx.ErrPeerClosed, io.EOF}
@@ -17,11 +17,11 @@
 
 package gnet
 
-import (
-	"io"
+import "github.com/panjf2000/gnet/v2/internal/netpoll"
 
-	"github.com/panjf2000/gnet/v2/internal/netpoll"
-)
+// recvmsgFlags is empty as MSG_CMSG_CLOEXEC is not available on all BSD platforms,
+// the received file descriptors are set close-on-exec after recvmsg instead.
+const recvmsgFlags = 0
 
 func (c *conn) handleEvents(_ int, filter int16, flags uint16) (err error) {
 	switch {
@@ -29,11 +29,12 @@ func (c *conn) handleEvents(_ int, filter int16, flags uint16) (err error) {
 	case flags&netpoll.EVFlagsEOF != 0:
 		switch {
 		case filter == netpoll.EVFilterRead: // read the remaining data after the peer wrote and closed immediately
+			c.peerShutdown = true
 			err = c.loop.read(c)
 		case filter == netpoll.EVFilterWrite && !c.outboundBuffer.IsEmpty():
 			err = c.loop.write(c)
 		default:
-			err = c.loop.close(c, io.EOF)
+			err = c.loop.close(c, errPeerClosed)
 		}
 	case filter == netpoll.EVFilterRead:
 		err = c.loop.read(c)
@@ -43,6 +44,37 @@ func (c *conn) handleEvents(_ int, filter int16, flags uint16) (err error) {
 	return
 }
 
+// pollConn registers the connection to the poller, the edge-triggered mode is only available with epoll.
+func (el *eventloop) pollConn(c *conn) error {
+	return el.poller.AddRead(&c.pollAttachment)
+}
+
+// stopReading stops watching the readable event of connection.
+func (c *conn) stopReading() error {
+	return c.loop.poller.ModWrite(&c.pollAttachment)
+}
+
+// startReading resumes watching the readable event of connection after stopReading.
+func (c *conn) startReading() error {
+	return c.loop.poller.AddRead(&c.pollAttachment)
+}
+
+// pausedPollWrite is pollWrite for the connection whose reading is stopped,
+// the readable and writable events are watched separately with kqueue.
+func (c *conn) pausedPollWrite() error {
+	return c.loop.poller.ModReadWrite(&c.pollAttachment)
+}
+
+// pausedUnpollWrite is unpollWrite for the connection whose reading is stopped.
+func (c *conn) pausedUnpollWrite() error {
+	return c.loop.poller.ModRead(&c.pollAttachment)
+}
+
+// rearm is a no-op as the connections are never edge-triggered with kqueue.
+func (el *eventloop) rearm(_ *conn) error {
+	return nil
+}
+
 func (el *eventloop) readUDP(fd int, filter netpoll.IOEvent, flags netpoll.IOFlags) error {
 	return el.readUDP1(fd, filter, flags)
 }
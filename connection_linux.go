@@ -17,7 +17,17 @@
 
 package gnet
 
-import "github.com/panjf2000/gnet/v2/internal/netpoll"
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/panjf2000/gnet/v2/internal/netpoll"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// recvmsgFlags makes the received file descriptors close-on-exec atomically.
+const recvmsgFlags = unix.MSG_CMSG_CLOEXEC
 
 func (c *conn) handleEvents(_ int, ev uint32) error {
 	// Don't change the ordering of processing EPOLLOUT | EPOLLRDHUP / EPOLLIN unless you're 100%
@@ -37,12 +47,73 @@ func (c *conn) handleEvents(_ int, ev uint32) error {
 		}
 	}
 	if ev&netpoll.InEvents != 0 {
+		c.peerShutdown = ev&unix.EPOLLRDHUP != 0
 		return c.loop.read(c)
 	}
 
 	return nil
 }
 
+// pollConn registers the connection to the poller, in edge-triggered mode if it's enabled.
+func (el *eventloop) pollConn(c *conn) error {
+	if el.engine.opts.EdgeTriggered && !c.isDatagram {
+		c.edgeTriggered = true
+		return el.poller.AddEdgeTriggered(&c.pollAttachment)
+	}
+	return el.poller.AddRead(&c.pollAttachment)
+}
+
+// stopReading stops watching the readable event of connection, the writable event is still
+// watched if there is pending data in the outbound buffer.
+func (c *conn) stopReading() error {
+	// A new readable edge comes with every segment from the peer in edge-triggered mode,
+	// so the readable events must be removed from the poller as well.
+	if c.edgeTriggered {
+		return c.loop.poller.ModEdgeTriggeredWrite(&c.pollAttachment)
+	}
+	if c.outboundBuffer.IsEmpty() {
+		return c.loop.poller.ModNone(&c.pollAttachment)
+	}
+	return c.loop.poller.ModWrite(&c.pollAttachment)
+}
+
+// startReading resumes watching the readable event of connection after stopReading.
+func (c *conn) startReading() error {
+	if c.edgeTriggered {
+		return c.loop.rearm(c)
+	}
+	if c.outboundBuffer.IsEmpty() {
+		return c.loop.poller.ModRead(&c.pollAttachment)
+	}
+	return c.loop.poller.ModReadWrite(&c.pollAttachment)
+}
+
+// pausedPollWrite is pollWrite for the connection whose reading is stopped.
+func (c *conn) pausedPollWrite() error {
+	return c.loop.poller.ModWrite(&c.pollAttachment)
+}
+
+// pausedUnpollWrite is unpollWrite for the connection whose reading is stopped.
+func (c *conn) pausedUnpollWrite() error {
+	return c.loop.poller.ModNone(&c.pollAttachment)
+}
+
+// rearm makes the poller report the pending events of the edge-triggered connection again.
+func (el *eventloop) rearm(c *conn) error {
+	return el.poller.RearmEdgeTriggered(&c.pollAttachment)
+}
+
 func (el *eventloop) readUDP(fd int, ev netpoll.IOEvent) error {
 	return el.readUDP1(fd, ev, 0)
 }
+
+func (c *conn) PeerCredentials() (*Credentials, error) {
+	if !c.isUnix() {
+		return nil, errorx.ErrUnsupportedUDSProtocol
+	}
+	cred, err := unix.GetsockoptUcred(c.fd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockopt", err)
+	}
+	return &Credentials{PID: int(cred.Pid), UID: int(cred.Uid), GID: int(cred.Gid)}, nil
+}
@@ -35,6 +35,7 @@ import (
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
 	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 type conn struct {
@@ -50,7 +51,19 @@ type conn struct {
 	inboundBuffer  elastic.RingBuffer     // buffer for leftover data from the peer
 	buffer         []byte                 // buffer for the latest bytes
 	isDatagram     bool                   // UDP protocol
+	isPacket       bool                   // message-oriented stream, i.e. SOCK_SEQPACKET
 	opened         bool                   // connection opened event fired
+	proxyPending   bool                   // waiting for the PROXY protocol header
+	proxyTimer     *time.Timer            // timer for reading the PROXY protocol header
+	proxyHeader    *proxyproto.Header     // PROXY protocol header from the peer
+	fds            []int                  // file descriptors received from the peer over unix domain socket
+	sizer          readSizer              // adaptive sizer of reads
+	edgeTriggered  bool                   // registered to the poller in edge-triggered mode
+	peerShutdown   bool                   // the peer has shut down the writing side of connection
+	readPaused     bool                   // reading is paused for the memory limit
+	admitted       bool                   // counted by the admission control of engine
+	inboundHeld    int64                  // bytes in inbound buffer accounted to the event-loop
+	outboundHeld   int64                  // bytes in outbound buffer accounted to the event-loop
 }
 
 func newTCPConn(fd int, el *eventloop, sa unix.Sockaddr, localAddr, remoteAddr net.Addr) (c *conn) {
@@ -63,7 +76,14 @@ func newTCPConn(fd int, el *eventloop, sa unix.Sockaddr, localAddr, remoteAddr n
 		pollAttachment: netpoll.PollAttachment{FD: fd},
 	}
 	c.pollAttachment.Callback = c.handleEvents
+	if el.alloc != nil {
+		c.inboundBuffer.SetAllocator(el.alloc)
+		c.outboundBuffer.SetAllocator(el.alloc)
+	}
 	c.outboundBuffer.Reset(el.engine.opts.WriteBufferCap)
+	if el.engine.opts.AdaptiveReadBuffer {
+		c.sizer.init(len(el.buffer))
+	}
 	return
 }
 
@@ -86,8 +106,16 @@ func newUDPConn(fd int, el *eventloop, localAddr net.Addr, sa unix.Sockaddr, con
 
 func (c *conn) release() {
 	c.opened = false
+	c.admitted = false
 	c.ctx = nil
 	c.buffer = nil
+	if c.proxyTimer != nil {
+		c.proxyTimer.Stop()
+		c.proxyTimer = nil
+	}
+	c.proxyPending = false
+	c.proxyHeader = nil
+	c.closeFDs()
 	if addr, ok := c.localAddr.(*net.TCPAddr); ok && c.localAddr != c.loop.ln.addr && len(addr.Zone) > 0 {
 		bsPool.Put(bs.StringToBytes(addr.Zone))
 	}
@@ -115,6 +143,11 @@ func (c *conn) open(buf []byte) error {
 		return unix.Send(c.fd, buf, 0)
 	}
 
+	if c.isPacket {
+		_, err := c.writePacket(buf)
+		return err
+	}
+
 	n, err := unix.Write(c.fd, buf)
 	if err != nil && err == unix.EAGAIN {
 		_, _ = c.outboundBuffer.Write(buf)
@@ -129,11 +162,16 @@ func (c *conn) open(buf []byte) error {
 }
 
 func (c *conn) write(data []byte) (n int, err error) {
+	if c.isPacket {
+		return c.writePacket(data)
+	}
+
 	n = len(data)
 	// If there is pending data in outbound buffer, the current data ought to be appended to the outbound buffer
 	// for maintaining the sequence of network packets.
 	if !c.outboundBuffer.IsEmpty() {
 		_, _ = c.outboundBuffer.Write(data)
+		c.account()
 		return
 	}
 
@@ -142,10 +180,11 @@ func (c *conn) write(data []byte) (n int, err error) {
 		// A temporary error occurs, append the data to outbound buffer, writing it back to the peer in the next round.
 		if err == unix.EAGAIN {
 			_, _ = c.outboundBuffer.Write(data)
-			err = c.loop.poller.ModReadWrite(&c.pollAttachment)
+			c.account()
+			err = c.pollWrite()
 			return
 		}
-		if err := c.loop.close(c, os.NewSyscallError("write", err)); err != nil {
+		if err := c.loop.close(c, &closeError{errorx.ErrWriteFailed, os.NewSyscallError("write", err)}); err != nil {
 			logging.Errorf("failed to close connection(fd=%d,peer=%+v) on conn.write: %v",
 				c.fd, c.remoteAddr, err)
 		}
@@ -154,12 +193,17 @@ func (c *conn) write(data []byte) (n int, err error) {
 	// Failed to send all data back to the peer, buffer the leftover data for the next round.
 	if sent < n {
 		_, _ = c.outboundBuffer.Write(data[sent:])
-		err = c.loop.poller.ModReadWrite(&c.pollAttachment)
+		c.account()
+		err = c.pollWrite()
 	}
 	return
 }
 
 func (c *conn) writev(bs [][]byte) (n int, err error) {
+	if c.isPacket {
+		return c.writevPacket(bs)
+	}
+
 	for _, b := range bs {
 		n += len(b)
 	}
@@ -168,6 +212,7 @@ func (c *conn) writev(bs [][]byte) (n int, err error) {
 	// for maintaining the sequence of network packets.
 	if !c.outboundBuffer.IsEmpty() {
 		_, _ = c.outboundBuffer.Writev(bs)
+		c.account()
 		return
 	}
 
@@ -176,10 +221,11 @@ func (c *conn) writev(bs [][]byte) (n int, err error) {
 		// A temporary error occurs, append the data to outbound buffer, writing it back to the peer in the next round.
 		if err == unix.EAGAIN {
 			_, _ = c.outboundBuffer.Writev(bs)
-			err = c.loop.poller.ModReadWrite(&c.pollAttachment)
+			c.account()
+			err = c.pollWrite()
 			return
 		}
-		if err := c.loop.close(c, os.NewSyscallError("writev", err)); err != nil {
+		if err := c.loop.close(c, &closeError{errorx.ErrWriteFailed, os.NewSyscallError("writev", err)}); err != nil {
 			logging.Errorf("failed to close connection(fd=%d,peer=%+v) on conn.writev: %v",
 				c.fd, c.remoteAddr, err)
 		}
@@ -198,11 +244,52 @@ func (c *conn) writev(bs [][]byte) (n int, err error) {
 			sent -= bn
 		}
 		_, _ = c.outboundBuffer.Writev(bs[pos:])
-		err = c.loop.poller.ModReadWrite(&c.pollAttachment)
+		c.account()
+		err = c.pollWrite()
+	}
+	return
+}
+
+// writePacket sends data as one message, which is never buffered as the messages would get merged
+// in the outbound buffer, it fails with EAGAIN if the socket is not writable.
+func (c *conn) writePacket(data []byte) (n int, err error) {
+	if n, err = unix.Write(c.fd, data); err != nil {
+		return 0, os.NewSyscallError("write", err)
+	}
+	return
+}
+
+// writevPacket is like writePacket but gathers bs into one message.
+func (c *conn) writevPacket(bs [][]byte) (n int, err error) {
+	if n, err = gio.Writev(c.fd, bs); err != nil {
+		return 0, os.NewSyscallError("writev", err)
 	}
 	return
 }
 
+// pollWrite starts watching the writable event for the pending data in outbound buffer,
+// the writable event is always watched in edge-triggered mode.
+func (c *conn) pollWrite() error {
+	if c.edgeTriggered {
+		return nil
+	}
+	if c.readPaused {
+		return c.pausedPollWrite()
+	}
+	return c.loop.poller.ModReadWrite(&c.pollAttachment)
+}
+
+// unpollWrite stops watching the writable event after the outbound buffer is drained.
+func (c *conn) unpollWrite() error {
+	if c.edgeTriggered {
+		return nil
+	}
+	if c.readPaused {
+		return c.pausedUnpollWrite()
+	}
+	return c.loop.poller.ModRead(&c.pollAttachment)
+}
+
 type asyncWriteHook struct {
 	callback AsyncCallback
 	data     []byte
@@ -306,6 +393,23 @@ func (c *conn) Next(n int) (buf []byte, err error) {
 	return c.loop.cache.Bytes(), err
 }
 
+func (c *conn) NextRetained(n int) (*RetainedBuffer, error) {
+	if len(c.buffer) > 0 && n <= len(c.buffer) && c.inboundBuffer.IsEmpty() {
+		// Lend the read buffer of event-loop, which will be replaced before the next read.
+		if n <= 0 {
+			n = len(c.buffer)
+		}
+		rb := &RetainedBuffer{b: c.buffer[:n:n], blk: c.loop.lendBuffer()}
+		c.buffer = c.buffer[n:]
+		return rb, nil
+	}
+	buf, err := c.Next(n)
+	if err != nil {
+		return nil, err
+	}
+	return retainCopy(buf), nil
+}
+
 func (c *conn) Peek(n int) (buf []byte, err error) {
 	inBufferLen := c.inboundBuffer.Buffered()
 	if totalLen := inBufferLen + len(c.buffer); n > totalLen {
@@ -332,6 +436,59 @@ func (c *conn) Peek(n int) (buf []byte, err error) {
 	return c.loop.cache.Bytes(), err
 }
 
+func (c *conn) PeekV(n int) ([][]byte, error) {
+	inBufferLen := c.inboundBuffer.Buffered()
+	if totalLen := inBufferLen + len(c.buffer); n > totalLen {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = totalLen
+	}
+	return c.peekV(n, inBufferLen), nil
+}
+
+func (c *conn) NextV(n int) ([][]byte, error) {
+	inBufferLen := c.inboundBuffer.Buffered()
+	if totalLen := inBufferLen + len(c.buffer); n > totalLen {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = totalLen
+	}
+	bs := c.peekV(n, inBufferLen)
+	if n < inBufferLen {
+		_, _ = c.inboundBuffer.Discard(n)
+		return bs, nil
+	}
+	// Keep the memory of inbound buffer that is referenced by bs till OnTraffic returns.
+	c.inboundBuffer.Reset()
+	c.buffer = c.buffer[n-inBufferLen:]
+	return bs, nil
+}
+
+// peekV returns the next n bytes as the segments of the inbound buffer and the read buffer.
+func (c *conn) peekV(n, inBufferLen int) [][]byte {
+	bs := c.loop.vecs[:0]
+	if inBufferLen > 0 {
+		head, tail := c.inboundBuffer.Peek(n)
+		bs = append(bs, head)
+		if len(tail) > 0 {
+			bs = append(bs, tail)
+		}
+	}
+	if n > inBufferLen {
+		bs = append(bs, c.buffer[:n-inBufferLen])
+	}
+	c.loop.vecs = bs
+	return bs
+}
+
+// releaseInbound gives the memory of inbound buffer back once it's drained, NextV leaves it
+// to be done after OnTraffic returns.
+func (c *conn) releaseInbound() {
+	if c.inboundBuffer.IsEmpty() {
+		c.inboundBuffer.Done()
+	}
+}
+
 func (c *conn) Discard(n int) (int, error) {
 	inBufferLen := c.inboundBuffer.Buffered()
 	tempBufferLen := len(c.buffer)
@@ -406,8 +563,25 @@ func (c *conn) OutboundBuffered() int {
 
 func (c *conn) Context() interface{}       { return c.ctx }
 func (c *conn) SetContext(ctx interface{}) { c.ctx = ctx }
-func (c *conn) LocalAddr() net.Addr        { return c.localAddr }
-func (c *conn) RemoteAddr() net.Addr       { return c.remoteAddr }
+
+func (c *conn) LocalAddr() net.Addr {
+	if c.proxyHeader != nil && c.proxyHeader.DestinationAddr != nil {
+		return c.proxyHeader.DestinationAddr
+	}
+	return c.localAddr
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	if c.proxyHeader != nil && c.proxyHeader.SourceAddr != nil {
+		return c.proxyHeader.SourceAddr
+	}
+	return c.remoteAddr
+}
+
+func (c *conn) ProxyHeader() *proxyproto.Header { return c.proxyHeader }
+
+func (c *conn) Loop() Loop     { return Loop{c.loop} }
+func (c *conn) LoopIndex() int { return c.loop.idx }
 
 // Implementation of Socket interface
 
@@ -443,6 +617,9 @@ func (c *conn) AsyncWrite(buf []byte, callback AsyncCallback) error {
 		}
 		return err
 	}
+	if c.loop.engine.rejectAsyncWrite() {
+		return errorx.ErrMemoryLimitExceeded
+	}
 	return c.loop.poller.Trigger(queue.HighPriority, c.asyncWrite, &asyncWriteHook{callback, buf})
 }
 
@@ -450,6 +627,9 @@ func (c *conn) AsyncWritev(bs [][]byte, callback AsyncCallback) error {
 	if c.isDatagram {
 		return errorx.ErrUnsupportedOp
 	}
+	if c.loop.engine.rejectAsyncWrite() {
+		return errorx.ErrMemoryLimitExceeded
+	}
 	return c.loop.poller.Trigger(queue.HighPriority, c.asyncWritev, &asyncWritevHook{callback, bs})
 }
 
@@ -465,7 +645,7 @@ func (c *conn) Wake(callback AsyncCallback) error {
 
 func (c *conn) CloseWithCallback(callback AsyncCallback) error {
 	return c.loop.poller.Trigger(queue.LowPriority, func(_ interface{}) (err error) {
-		err = c.loop.close(c, nil)
+		err = c.loop.close(c, errorx.ErrLocalClosed)
 		if callback != nil {
 			_ = callback(c, err)
 		}
@@ -475,7 +655,7 @@ func (c *conn) CloseWithCallback(callback AsyncCallback) error {
 
 func (c *conn) Close() error {
 	return c.loop.poller.Trigger(queue.LowPriority, func(_ interface{}) (err error) {
-		err = c.loop.close(c, nil)
+		err = c.loop.close(c, errorx.ErrLocalClosed)
 		return
 	}, nil)
 }
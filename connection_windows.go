@@ -26,6 +26,7 @@ import (
 	"github.com/panjf2000/gnet/v2/pkg/buffer/elastic"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	bbPool "github.com/panjf2000/gnet/v2/pkg/pool/bytebuffer"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 type netErr struct {
@@ -33,6 +34,18 @@ type netErr struct {
 	err error
 }
 
+// netCloseReason converts the error of reading a connection to the reason of closing it.
+func netCloseReason(err error) error {
+	switch {
+	case err == io.EOF:
+		return errPeerClosed
+	case errors.Is(err, windows.WSAECONNRESET), errors.Is(err, syscall.ECONNRESET):
+		return &closeError{errorx.ErrPeerReset, err}
+	default:
+		return err
+	}
+}
+
 type tcpConn struct {
 	c   *conn
 	buf *bbPool.ByteBuffer
@@ -56,6 +69,10 @@ type conn struct {
 	localAddr     net.Addr           // local server addr
 	remoteAddr    net.Addr           // remote peer addr
 	inboundBuffer elastic.RingBuffer // buffer for data from the peer
+	proxyPending  bool               // waiting for the PROXY protocol header
+	proxyTimer    *time.Timer        // timer for reading the PROXY protocol header
+	proxyHeader   *proxyproto.Header // PROXY protocol header from the peer
+	admitted      bool               // counted by the admission control of engine
 }
 
 func packTCPConn(c *conn, buf []byte) *tcpConn {
@@ -85,6 +102,9 @@ func newTCPConn(nc net.Conn, el *eventloop) (c *conn) {
 		loop:    el,
 		rawConn: nc,
 	}
+	if el.alloc != nil {
+		c.inboundBuffer.SetAllocator(el.alloc)
+	}
 	c.localAddr = c.rawConn.LocalAddr()
 	c.remoteAddr = c.rawConn.RemoteAddr()
 	return
@@ -92,6 +112,13 @@ func newTCPConn(nc net.Conn, el *eventloop) (c *conn) {
 
 func (c *conn) release() {
 	c.ctx = nil
+	c.admitted = false
+	if c.proxyTimer != nil {
+		c.proxyTimer.Stop()
+		c.proxyTimer = nil
+	}
+	c.proxyPending = false
+	c.proxyHeader = nil
 	c.localAddr = nil
 	if c.rawConn != nil {
 		c.rawConn = nil
@@ -179,6 +206,14 @@ func (c *conn) Next(n int) (buf []byte, err error) {
 	return c.loop.cache.Bytes(), err
 }
 
+func (c *conn) NextRetained(n int) (*RetainedBuffer, error) {
+	buf, err := c.Next(n)
+	if err != nil {
+		return nil, err
+	}
+	return retainCopy(buf), nil
+}
+
 func (c *conn) Peek(n int) (buf []byte, err error) {
 	if c.buffer == nil {
 		if n <= 0 {
@@ -212,6 +247,73 @@ func (c *conn) Peek(n int) (buf []byte, err error) {
 	return c.loop.cache.Bytes(), err
 }
 
+func (c *conn) PeekV(n int) ([][]byte, error) {
+	if c.buffer == nil {
+		if n <= 0 {
+			return nil, nil
+		}
+		return nil, io.ErrShortBuffer
+	}
+
+	inBufferLen := c.inboundBuffer.Buffered()
+	if totalLen := inBufferLen + c.buffer.Len(); n > totalLen {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = totalLen
+	}
+	return c.peekV(n, inBufferLen), nil
+}
+
+func (c *conn) NextV(n int) ([][]byte, error) {
+	if c.buffer == nil {
+		if n <= 0 {
+			return nil, nil
+		}
+		return nil, io.ErrShortBuffer
+	}
+
+	inBufferLen := c.inboundBuffer.Buffered()
+	if totalLen := inBufferLen + c.buffer.Len(); n > totalLen {
+		return nil, io.ErrShortBuffer
+	} else if n <= 0 {
+		n = totalLen
+	}
+	bs := c.peekV(n, inBufferLen)
+	if n < inBufferLen {
+		_, _ = c.inboundBuffer.Discard(n)
+		return bs, nil
+	}
+	// Keep the memory of inbound buffer that is referenced by bs till OnTraffic returns.
+	c.inboundBuffer.Reset()
+	c.buffer.B = c.buffer.B[n-inBufferLen:]
+	return bs, nil
+}
+
+// peekV returns the next n bytes as the segments of the inbound buffer and the temporary buffer.
+func (c *conn) peekV(n, inBufferLen int) [][]byte {
+	bs := c.loop.vecs[:0]
+	if inBufferLen > 0 {
+		head, tail := c.inboundBuffer.Peek(n)
+		bs = append(bs, head)
+		if len(tail) > 0 {
+			bs = append(bs, tail)
+		}
+	}
+	if n > inBufferLen {
+		bs = append(bs, c.buffer.B[:n-inBufferLen])
+	}
+	c.loop.vecs = bs
+	return bs
+}
+
+// releaseInbound gives the memory of inbound buffer back once it's drained, NextV leaves it
+// to be done after OnTraffic returns.
+func (c *conn) releaseInbound() {
+	if c.inboundBuffer.IsEmpty() {
+		c.inboundBuffer.Done()
+	}
+}
+
 func (c *conn) Discard(n int) (int, error) {
 	if c.buffer == nil {
 		return 0, nil
@@ -296,10 +398,35 @@ func (c *conn) OutboundBuffered() int {
 	return 0
 }
 
+func (c *conn) ReadFDs() []int {
+	return nil
+}
+
+func (c *conn) WriteWithFDs(_ []byte, _ []int) (int, error) {
+	return 0, errorx.ErrUnsupportedOp
+}
+
 func (c *conn) Context() interface{}       { return c.ctx }
 func (c *conn) SetContext(ctx interface{}) { c.ctx = ctx }
-func (c *conn) LocalAddr() net.Addr        { return c.localAddr }
-func (c *conn) RemoteAddr() net.Addr       { return c.remoteAddr }
+
+func (c *conn) LocalAddr() net.Addr {
+	if c.proxyHeader != nil && c.proxyHeader.DestinationAddr != nil {
+		return c.proxyHeader.DestinationAddr
+	}
+	return c.localAddr
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	if c.proxyHeader != nil && c.proxyHeader.SourceAddr != nil {
+		return c.proxyHeader.SourceAddr
+	}
+	return c.remoteAddr
+}
+
+func (c *conn) ProxyHeader() *proxyproto.Header { return c.proxyHeader }
+
+func (c *conn) Loop() Loop     { return Loop{c.loop} }
+func (c *conn) LoopIndex() int { return c.loop.idx }
 
 func (c *conn) Fd() (fd int) {
 	if c.rawConn == nil {
@@ -397,6 +524,10 @@ func (c *conn) SetLinger(sec int) error {
 	return tc.SetLinger(sec)
 }
 
+func (c *conn) PeerCredentials() (*Credentials, error) {
+	return nil, errorx.ErrUnsupportedOp
+}
+
 func (c *conn) SetNoDelay(noDelay bool) error {
 	if c.rawConn == nil {
 		return net.ErrClosed
@@ -479,7 +610,7 @@ func (c *conn) Wake(cb AsyncCallback) error {
 
 func (c *conn) Close() error {
 	c.loop.ch <- func() error {
-		err := c.loop.close(c, nil)
+		err := c.loop.close(c, errorx.ErrLocalClosed)
 		return err
 	}
 	return nil
@@ -497,7 +628,7 @@ func (c *conn) CloseWithCallback(cb AsyncCallback) error {
 			}
 			_ = cb(c, err)
 		}()
-		return c.loop.close(c, nil)
+		return c.loop.close(c, errorx.ErrLocalClosed)
 	}
 	return nil
 }
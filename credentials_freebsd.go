@@ -0,0 +1,42 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build freebsd
+// +build freebsd
+
+package gnet
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// PeerCredentials leaves PID as 0 since the process ID of peer is not exposed by xucred.
+func (c *conn) PeerCredentials() (*Credentials, error) {
+	if !c.isUnix() {
+		return nil, errorx.ErrUnsupportedUDSProtocol
+	}
+	xucred, err := unix.GetsockoptXucred(c.fd, unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockopt", err)
+	}
+	cred := &Credentials{UID: int(xucred.Uid)}
+	if xucred.Ngroups > 0 {
+		cred.GID = int(xucred.Groups[0])
+	}
+	return cred, nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+func (eng *engine) isDraining() bool {
+	return atomic.LoadInt32(&eng.draining) == 1
+}
+
+// waitForDrain waits until all connections have been closed or ctx is done.
+func (eng *engine) waitForDrain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		var count int32
+		eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+			count += el.countConn()
+			return true
+		})
+		if count == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			eng.opts.Logger.Warnf("draining is interrupted with %d connections remaining: %v", count, ctx.Err())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// onDrain notifies c that the engine is draining.
+func (el *eventloop) onDrain(c *conn) Action {
+	if h, ok := el.eventHandler.(DrainHandler); ok {
+		return h.OnDrain(c)
+	}
+	return None
+}
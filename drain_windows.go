@@ -0,0 +1,50 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// drain stops accepting new connections, notifies all connections of draining
+// and waits for them to be closed until ctx is done.
+func (eng *engine) drain(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&eng.draining, 0, 1) {
+		return nil
+	}
+
+	// The acceptor closes new connections as soon as they are accepted from now on.
+	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		el.ch <- el.drain
+		return true
+	})
+
+	return eng.waitForDrain(ctx)
+}
+
+func (el *eventloop) drain() error {
+	for c := range el.connections {
+		if c.proxyPending {
+			continue // the connection hasn't been opened yet
+		}
+		if err := el.handleAction(c, el.onDrain(c)); err == errors.ErrEngineShutdown {
+			return err
+		}
+	}
+	return nil
+}
@@ -32,12 +32,17 @@ import (
 )
 
 type engine struct {
-	ln         *listener    // the listener for accepting new connections
-	opts       *Options     // options with engine
-	acceptor   *eventloop   // main event-loop for accepting connections
-	eventLoops loadBalancer // event-loops for handling events
-	inShutdown int32        // whether the engine is in shutdown
-	ticker     struct {
+	memoryUsed     int64        // bytes held in the buffers of all connections, accessed atomically
+	ln             *listener    // the listener for accepting new connections
+	opts           *Options     // options with engine
+	acceptor       *eventloop   // main event-loop for accepting connections
+	accepted       []*conn      // scratch buffer of the connections accepted in a batch by the main reactor
+	eventLoops     loadBalancer // event-loops for handling events
+	inShutdown     int32        // whether the engine is in shutdown
+	draining       int32        // whether the engine is draining connections
+	readsPaused    int32        // whether there are connections paused for the memory limit
+	closingLargest int32        // whether the largest connection is being closed for the memory limit
+	ticker         struct {
 		ctx    context.Context    // context for ticker
 		cancel context.CancelFunc // function to stop the ticker
 	}
@@ -48,6 +53,10 @@ type engine struct {
 		shutdown    context.CancelFunc
 		once        sync.Once
 	}
+	admission    *admission   // admission control of new connections
+	acl          atomic.Value // access control of source IPs, *accessControl
+	acceptMu     sync.Mutex   // protects acceptPaused
+	acceptPaused bool         // whether the listeners are removed from the pollers
 	eventHandler EventHandler // user eventHandler
 }
 
@@ -113,6 +122,7 @@ func (eng *engine) activateEventLoops(numEventLoop int) (err error) {
 			el.engine = eng
 			el.poller = p
 			el.buffer = make([]byte, eng.opts.ReadBufferCap)
+			el.alloc = newLoopAllocator(eng.opts)
 			el.connections.init()
 			el.eventHandler = eng.eventHandler
 			if err = el.poller.AddRead(el.ln.packPollAttachment(el.accept)); err != nil {
@@ -129,6 +139,14 @@ func (eng *engine) activateEventLoops(numEventLoop int) (err error) {
 		}
 	}
 
+	// Steer the incoming connections among the listeners of event-loops,
+	// the order of sockets in the SO_REUSEPORT group matches the order of event-loops.
+	if eng.opts.ReusePort {
+		if err = eng.ln.steer(eng.opts.ReusePortSteering, numEventLoop); err != nil {
+			return
+		}
+	}
+
 	// Start event-loops in background.
 	eng.startEventLoops()
 
@@ -136,6 +154,7 @@ func (eng *engine) activateEventLoops(numEventLoop int) (err error) {
 		striker.ticker(eng.ticker.ctx)
 		return nil
 	})
+	eng.startLoopTickers()
 
 	return
 }
@@ -148,6 +167,7 @@ func (eng *engine) activateReactors(numEventLoop int) error {
 			el.engine = eng
 			el.poller = p
 			el.buffer = make([]byte, eng.opts.ReadBufferCap)
+			el.alloc = newLoopAllocator(eng.opts)
 			el.connections.init()
 			el.eventHandler = eng.eventHandler
 			eng.eventLoops.register(el)
@@ -184,12 +204,27 @@ func (eng *engine) activateReactors(numEventLoop int) error {
 			return nil
 		})
 	}
+	eng.startLoopTickers()
 
 	return nil
 }
 
+func (eng *engine) startLoopTickers() {
+	h, ok := eng.eventHandler.(LoopTickHandler)
+	if !ok || !eng.opts.LoopTicker {
+		return
+	}
+	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		eng.workerPool.Go(func() error {
+			el.loopTicker(eng.ticker.ctx, h)
+			return nil
+		})
+		return true
+	})
+}
+
 func (eng *engine) start(numEventLoop int) error {
-	if eng.opts.ReusePort || eng.ln.network == "udp" {
+	if eng.opts.ReusePort || eng.ln.isDatagram() {
 		return eng.activateEventLoops(numEventLoop)
 	}
 
@@ -245,6 +280,15 @@ func run(eventHandler EventHandler, listener *listener, options *Options, protoA
 	if numEventLoop > gfd.EventLoopIndexMax {
 		numEventLoop = gfd.EventLoopIndexMax
 	}
+	if listener.network == "unixgram" {
+		// The socket file can't be bound more than once, thus it's served by a single event-loop.
+		numEventLoop = 1
+	}
+
+	acl, err := newAccessControl(options.AllowedCIDRs, options.DeniedCIDRs)
+	if err != nil {
+		return err
+	}
 
 	shutdownCtx, shutdown := context.WithCancel(context.Background())
 	eng := engine{
@@ -256,6 +300,7 @@ func run(eventHandler EventHandler, listener *listener, options *Options, protoA
 			shutdown    context.CancelFunc
 			once        sync.Once
 		}{&errgroup.Group{}, shutdownCtx, shutdown, sync.Once{}},
+		admission:    newAdmission(options),
 		eventHandler: eventHandler,
 	}
 	switch options.LB {
@@ -266,8 +311,14 @@ func run(eventHandler EventHandler, listener *listener, options *Options, protoA
 	case SourceAddrHash:
 		eng.eventLoops = new(sourceAddrHashLoadBalancer)
 	}
+	if options.LoadBalancer != nil {
+		eng.eventLoops = &customLoadBalancer{lb: options.LoadBalancer}
+	}
+	if acl != nil {
+		eng.acl.Store(acl)
+	}
 
-	if eng.opts.Ticker {
+	if eng.opts.Ticker || eng.opts.LoopTicker {
 		eng.ticker.ctx, eng.ticker.cancel = context.WithCancel(context.Background())
 	}
 
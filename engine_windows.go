@@ -27,6 +27,7 @@ import (
 )
 
 type engine struct {
+	memoryUsed int64 // always zero as the memory held in buffers is not tracked on Windows
 	ln         *listener
 	opts       *Options     // options with engine
 	eventLoops loadBalancer // event-loops for handling events
@@ -36,6 +37,7 @@ type engine struct {
 	}
 	inShutdown    int32 // whether the engine is in shutdown
 	beingShutdown int32 // whether the engine is being shutdown
+	draining      int32 // whether the engine is draining connections
 	workerPool    struct {
 		*errgroup.Group
 
@@ -43,6 +45,8 @@ type engine struct {
 		shutdown    context.CancelFunc
 		once        sync.Once
 	}
+	admission    *admission   // admission control of new connections
+	acl          atomic.Value // access control of source IPs, *accessControl
 	eventHandler EventHandler // user eventHandler
 }
 
@@ -74,6 +78,7 @@ func (eng *engine) start(numEventLoop int) error {
 			idx:          i,
 			eng:          eng,
 			connections:  make(map[*conn]struct{}),
+			alloc:        newLoopAllocator(eng.opts),
 			eventHandler: eng.eventHandler,
 		}
 		eng.eventLoops.register(&el)
@@ -86,11 +91,27 @@ func (eng *engine) start(numEventLoop int) error {
 		}
 	}
 
+	eng.startLoopTickers()
+
 	eng.workerPool.Go(eng.listen)
 
 	return nil
 }
 
+func (eng *engine) startLoopTickers() {
+	h, ok := eng.eventHandler.(LoopTickHandler)
+	if !ok || !eng.opts.LoopTicker {
+		return
+	}
+	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		eng.workerPool.Go(func() error {
+			el.loopTicker(eng.ticker.ctx, h)
+			return nil
+		})
+		return true
+	})
+}
+
 func (eng *engine) stop(engine Engine) error {
 	<-eng.workerPool.shutdownCtx.Done()
 
@@ -121,10 +142,16 @@ func run(eventHandler EventHandler, listener *listener, options *Options, protoA
 		numEventLoop = options.NumEventLoop
 	}
 
+	acl, err := newAccessControl(options.AllowedCIDRs, options.DeniedCIDRs)
+	if err != nil {
+		return err
+	}
+
 	shutdownCtx, shutdown := context.WithCancel(context.Background())
 	eng := engine{
 		opts:         options,
 		eventHandler: eventHandler,
+		admission:    newAdmission(options),
 		ln:           listener,
 		workerPool: struct {
 			*errgroup.Group
@@ -142,8 +169,14 @@ func run(eventHandler EventHandler, listener *listener, options *Options, protoA
 	case SourceAddrHash:
 		eng.eventLoops = new(sourceAddrHashLoadBalancer)
 	}
+	if options.LoadBalancer != nil {
+		eng.eventLoops = &customLoadBalancer{lb: options.LoadBalancer}
+	}
+	if acl != nil {
+		eng.acl.Store(acl)
+	}
 
-	if options.Ticker {
+	if options.Ticker || options.LoopTicker {
 		eng.ticker.ctx, eng.ticker.cancel = context.WithCancel(context.Background())
 	}
 
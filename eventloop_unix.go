@@ -23,7 +23,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -31,19 +32,36 @@ import (
 	"github.com/panjf2000/gnet/v2/internal/io"
 	"github.com/panjf2000/gnet/v2/internal/netpoll"
 	"github.com/panjf2000/gnet/v2/internal/queue"
+	"github.com/panjf2000/gnet/v2/internal/socket"
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
+	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
 )
 
 type eventloop struct {
-	ln           *listener       // listener
-	idx          int             // loop index in the engine loops list
-	cache        bytes.Buffer    // temporary buffer for scattered bytes
-	engine       *engine         // engine in loop
-	poller       *netpoll.Poller // epoll or kqueue
-	buffer       []byte          // read packet buffer whose capacity is set by user, default value is 64KB
-	connections  connMatrix      // loop connections storage
-	eventHandler EventHandler    // user eventHandler
+	inboundBytes  int64                     // bytes held in the inbound buffers of connections, accessed atomically
+	outboundBytes int64                     // bytes held in the outbound buffers of connections, accessed atomically
+	assigned      int32                     // connections assigned by the main reactor but not registered yet, accessed atomically
+	ln            *listener                 // listener
+	idx           int                       // loop index in the engine loops list
+	cache         bytes.Buffer              // temporary buffer for scattered bytes
+	vecs          [][]byte                  // segments of inbound data returned by Conn.PeekV and Conn.NextV
+	engine        *engine                   // engine in loop
+	poller        *netpoll.Poller           // epoll or kqueue
+	buffer        []byte                    // read packet buffer whose capacity is set by user, default value is 64KB
+	alloc         allocator.BufferAllocator // allocator of the buffers of connections, nil for the built-in pools
+	lent          *retainedBlock            // block of the read buffer lent out to RetainedBuffers
+	iteration     uint64                    // the round of polling in which the traffic budget is being spent
+	trafficStart  time.Time                 // the time when the traffic budget started to be spent
+	oob           []byte                    // buffer for ancillary data from unix domain sockets
+	connections   connMatrix                // loop connections storage
+	paused        []*conn                   // connections whose reading is paused for the memory limit
+	redelivering  bool                      // whether OnTraffic is scheduled for the paused connections
+	futures       pendingFutures            // futures of the tasks queued up in the loop
+	userFDs       sync.Map                  // user file descriptors registered on the loop, fd -> *RegisteredFD
+	ctx           interface{}               // user-defined context
+	eventHandler  EventHandler              // user eventHandler
 }
 
 func (el *eventloop) getLogger() logging.Logger {
@@ -54,12 +72,30 @@ func (el *eventloop) countConn() int32 {
 	return el.connections.loadCount()
 }
 
+// countAssigned returns the number of connections assigned to the event-loop but not registered yet.
+func (el *eventloop) countAssigned() int32 {
+	return atomic.LoadInt32(&el.assigned)
+}
+
+func (el *eventloop) countPendingTasks() int {
+	return el.poller.PendingTasks()
+}
+
 func (el *eventloop) closeConns() {
 	// Close loops and all outstanding connections
 	el.connections.iterate(func(c *conn) bool {
-		_ = el.close(c, nil)
+		_ = el.close(c, errorx.ErrEngineShutdown)
 		return true
 	})
+
+	// Give the read buffer back to the pool, or drop the reference to it if it's lent out.
+	if el.lent != nil {
+		el.lent.release()
+		el.lent = nil
+	} else {
+		bsPool.Put(el.buffer)
+	}
+	el.buffer = nil
 }
 
 type connWithCallback struct {
@@ -75,8 +111,11 @@ func (el *eventloop) register(itf interface{}) error {
 		defer ccb.cb()
 	}
 
-	if err := el.poller.AddRead(&c.pollAttachment); err != nil {
+	if err := el.pollConn(c); err != nil {
 		_ = unix.Close(c.fd)
+		if c.admitted {
+			el.engine.admission.leave(c.remoteAddr)
+		}
 		c.release()
 		return err
 	}
@@ -91,7 +130,18 @@ func (el *eventloop) register(itf interface{}) error {
 
 func (el *eventloop) open(c *conn) error {
 	c.opened = true
+	if c.proxyPending {
+		// Defer OnOpen until the PROXY protocol header is received.
+		c.proxyTimer = time.AfterFunc(el.engine.opts.ProxyProtocolTimeout, func() {
+			_ = el.poller.Trigger(queue.HighPriority, el.proxyTimeout, c)
+		})
+		return nil
+	}
 
+	return el.fireOpen(c)
+}
+
+func (el *eventloop) fireOpen(c *conn) error {
 	out, action := el.eventHandler.OnOpen(c)
 	if out != nil {
 		if err := c.open(out); err != nil {
@@ -100,37 +150,211 @@ func (el *eventloop) open(c *conn) error {
 	}
 
 	if !c.outboundBuffer.IsEmpty() {
-		if err := el.poller.ModReadWrite(&c.pollAttachment); err != nil {
+		c.account()
+		if err := c.pollWrite(); err != nil {
 			return err
 		}
 	}
 
+	if action == None && el.engine.isDraining() {
+		// The connection was accepted right before the engine started draining.
+		action = el.onDrain(c)
+	}
 	return el.handleAction(c, action)
 }
 
+// lendBuffer lends the read buffer out to a RetainedBuffer.
+func (el *eventloop) lendBuffer() *retainedBlock {
+	if el.lent == nil {
+		// The event-loop holds a reference until the read buffer is renewed.
+		el.lent = newRetainedBlock(el.buffer)
+	}
+	el.lent.retain()
+	return el.lent
+}
+
+// renewBuffer replaces the read buffer that has been lent out with a new one from the pool.
+func (el *eventloop) renewBuffer() {
+	if el.lent == nil {
+		return
+	}
+	el.lent.release()
+	el.lent = nil
+	el.buffer = bsPool.Get(len(el.buffer))
+}
+
+// trafficBudgetExhausted reports whether the time budget for serving the readable connections
+// in the current round of polling runs out.
+func (el *eventloop) trafficBudgetExhausted() bool {
+	budget := el.engine.opts.LoopTrafficBudget
+	if budget <= 0 {
+		return false
+	}
+	if it := el.poller.Iteration(); it != el.iteration {
+		el.iteration = it
+		el.trafficStart = time.Now()
+		return false
+	}
+	return time.Since(el.trafficStart) >= budget
+}
+
 func (el *eventloop) read(c *conn) error {
-	n, err := unix.Read(c.fd, el.buffer)
+	// The connection remains readable and will be served in the next round of polling.
+	if el.trafficBudgetExhausted() {
+		return el.resumeRead(c)
+	}
+
+	reads, budget := el.engine.opts.ReadBudgetReads, el.engine.opts.ReadBudgetBytes
+	if reads <= 0 {
+		reads = maxReadsPerEvent
+	}
+	for i := 0; i < reads; i++ {
+		if ok, err := el.enforceMemoryLimit(c); !ok {
+			return err
+		}
+		limit := len(el.buffer)
+		if budget > 0 && budget < limit && !c.isPacket {
+			limit = budget
+		}
+		n, more, err := el.read1(c, limit)
+		if !more || err != nil {
+			return err
+		}
+		if budget > 0 {
+			if budget -= n; budget <= 0 {
+				return el.resumeRead(c)
+			}
+		}
+		if el.trafficBudgetExhausted() {
+			return el.resumeRead(c)
+		}
+	}
+	return el.resumeRead(c)
+}
+
+// resumeRead arranges for the connection that has not been drained to be read again
+// in the next round of polling.
+func (el *eventloop) resumeRead(c *conn) error {
+	// The readable event keeps coming in level-triggered mode.
+	if !c.edgeTriggered {
+		return nil
+	}
+	return el.rearm(c)
+}
+
+// read1 reads at most limit bytes from the connection once and fires OnTraffic, it reports
+// the number of bytes read and whether there might be more data to read.
+func (el *eventloop) read1(c *conn, limit int) (int, bool, error) {
+	el.renewBuffer()
+
+	var (
+		n   int
+		err error
+	)
+	// Messages must be read in whole, thus the read size is only adjusted for stream.
+	if c.sizer.limit > 0 && c.sizer.size() < limit && !c.isPacket {
+		limit = c.sizer.size()
+	}
+	buf := el.buffer[:limit]
+	if c.isUnix() {
+		n, err = el.recvmsg(c, buf)
+	} else {
+		n, err = unix.Read(c.fd, buf)
+	}
 	if err != nil || n == 0 {
 		if err == unix.EAGAIN {
-			return nil
+			return n, false, nil
 		}
-		if n == 0 {
-			err = unix.ECONNRESET
+		return n, false, el.close(c, readCloseReason(err))
+	}
+	c.sizer.record(n)
+	// A short read indicates that the socket has been drained, except for the message-oriented socket,
+	// and the socket must be read until EAGAIN in edge-triggered mode.
+	more := n == len(buf) || c.isPacket || c.edgeTriggered
+
+	c.buffer = buf[:n]
+	if c.proxyPending {
+		if ok, err := el.readProxyHeader(c); !ok {
+			return n, more && err == nil && c.opened, err
 		}
-		return el.close(c, os.NewSyscallError("read", err))
 	}
-
-	c.buffer = el.buffer[:n]
 	action := el.eventHandler.OnTraffic(c)
 	switch action {
 	case None:
 	case Close:
-		return el.close(c, nil)
+		return n, false, el.close(c, errorx.ErrHandlerClosed)
 	case Shutdown:
-		return errorx.ErrEngineShutdown
+		return n, false, errorx.ErrEngineShutdown
+	}
+	if !c.opened {
+		return n, false, nil // the connection was closed in OnTraffic
+	}
+	// Each message is delivered on its own, the unread part of it is discarded.
+	if !c.isPacket {
+		_, _ = c.inboundBuffer.Write(c.buffer)
+		c.releaseInbound()
 	}
-	_, _ = c.inboundBuffer.Write(c.buffer)
 	c.buffer = c.buffer[:0]
+	c.account()
+	if !more && c.peerShutdown {
+		// The peer has shut down the writing side and all data have been read, don't wait for EOF.
+		return n, false, el.close(c, errPeerClosed)
+	}
+	return n, more, nil
+}
+
+// readCloseReason converts the error of reading a connection to the reason of closing it,
+// a nil error means EOF.
+func readCloseReason(err error) error {
+	switch err {
+	case nil:
+		return errPeerClosed
+	case unix.ECONNRESET:
+		return &closeError{errorx.ErrPeerReset, os.NewSyscallError("read", err)}
+	default:
+		return os.NewSyscallError("read", err)
+	}
+}
+
+// readProxyHeader tries to consume the PROXY protocol header from the inbound data and fires OnOpen
+// once it's done, it reports whether there is leftover data for OnTraffic.
+func (el *eventloop) readProxyHeader(c *conn) (bool, error) {
+	ok, err := c.parseProxyHeader(el.engine.opts.ProxyProtocol)
+	if err != nil {
+		return false, el.close(c, err)
+	}
+	if !ok {
+		_, _ = c.inboundBuffer.Write(c.buffer)
+		c.buffer = c.buffer[:0]
+		return false, nil
+	}
+
+	c.proxyPending = false
+	c.proxyTimer.Stop()
+	if err = el.fireOpen(c); err != nil || !c.opened {
+		return false, err
+	}
+	return c.InboundBuffered() > 0, nil
+}
+
+// proxyTimeout fires when the PROXY protocol header is not received in time.
+func (el *eventloop) proxyTimeout(arg interface{}) error {
+	c := arg.(*conn)
+	if !c.opened || !c.proxyPending || el.connections.getConn(c.fd) != c {
+		return nil // ignore stale connections
+	}
+
+	if el.engine.opts.ProxyProtocol == ProxyProtocolRequired {
+		return el.close(c, errorx.ErrProxyHeaderTimeout)
+	}
+	// Serve the connection without header, the partial data which looks like a header is kept.
+	c.proxyPending = false
+	if err := el.fireOpen(c); err != nil || !c.opened {
+		return err
+	}
+	if c.InboundBuffered() > 0 {
+		return el.wake(c)
+	}
 	return nil
 }
 
@@ -138,39 +362,47 @@ func (el *eventloop) read(c *conn) error {
 const iovMax = 1024
 
 func (el *eventloop) write(c *conn) error {
-	iov := c.outboundBuffer.Peek(-1)
-	var (
-		n   int
-		err error
-	)
-	if len(iov) > 1 {
-		if len(iov) > iovMax {
-			iov = iov[:iovMax]
+	for {
+		iov := c.outboundBuffer.Peek(-1)
+		var (
+			n   int
+			err error
+		)
+		if len(iov) > 1 {
+			if len(iov) > iovMax {
+				iov = iov[:iovMax]
+			}
+			n, err = io.Writev(c.fd, iov)
+		} else {
+			n, err = unix.Write(c.fd, iov[0])
+		}
+		_, _ = c.outboundBuffer.Discard(n)
+		c.account()
+		switch err {
+		case nil:
+		case unix.EAGAIN:
+			return nil
+		default:
+			return el.close(c, &closeError{errorx.ErrWriteFailed, os.NewSyscallError("write", err)})
+		}
+		if c.outboundBuffer.IsEmpty() {
+			break
+		}
+		// In edge-triggered mode, the writable event won't come again until the socket is full.
+		if !c.edgeTriggered {
+			return nil
 		}
-		n, err = io.Writev(c.fd, iov)
-	} else {
-		n, err = unix.Write(c.fd, iov[0])
-	}
-	_, _ = c.outboundBuffer.Discard(n)
-	switch err {
-	case nil:
-	case unix.EAGAIN:
-		return nil
-	default:
-		return el.close(c, os.NewSyscallError("write", err))
 	}
 
 	// All data have been drained, it's no need to monitor the writable events,
 	// remove the writable event from poller to help the future event-loops.
-	if c.outboundBuffer.IsEmpty() {
-		_ = el.poller.ModRead(&c.pollAttachment)
-	}
+	_ = c.unpollWrite()
 
 	return nil
 }
 
 func (el *eventloop) close(c *conn, err error) (rerr error) {
-	if addr := c.localAddr; addr != nil && strings.HasPrefix(c.localAddr.Network(), "udp") {
+	if addr := c.localAddr; addr != nil && c.isDatagram {
 		rerr = el.poller.Delete(c.fd)
 		if c.fd != el.ln.fd {
 			rerr = unix.Close(c.fd)
@@ -217,7 +449,12 @@ func (el *eventloop) close(c *conn, err error) (rerr error) {
 	}
 
 	el.connections.delConn(c)
-	if el.eventHandler.OnClose(c, err) == Shutdown {
+	if c.admitted {
+		el.engine.admission.leave(c.remoteAddr)
+	}
+	c.unaccount()
+	// OnClose doesn't fire if OnOpen didn't fire due to the absence of PROXY protocol header.
+	if !c.proxyPending && el.eventHandler.OnClose(c, err) == Shutdown {
 		rerr = errorx.ErrEngineShutdown
 	}
 	c.release()
@@ -231,10 +468,26 @@ func (el *eventloop) wake(c *conn) error {
 	}
 
 	action := el.eventHandler.OnTraffic(c)
+	c.releaseInbound()
+	c.account()
 
 	return el.handleAction(c, action)
 }
 
+func (el *eventloop) submit(priority TaskPriority, fn func()) error {
+	if el.engine.workerPool.shutdownCtx.Err() != nil || el.futures.isStopped() {
+		return errorx.ErrEngineShutdown
+	}
+	p := queue.LowPriority
+	if priority == TaskPriorityHigh {
+		p = queue.HighPriority
+	}
+	return el.poller.Trigger(p, func(_ interface{}) error {
+		fn()
+		return nil
+	}, nil)
+}
+
 func (el *eventloop) ticker(ctx context.Context) {
 	if el == nil {
 		return
@@ -273,12 +526,57 @@ func (el *eventloop) ticker(ctx context.Context) {
 	}
 }
 
+// loopTicker runs h.OnLoopTick on the goroutine of el periodically until ctx is done.
+func (el *eventloop) loopTicker(ctx context.Context, h LoopTickHandler) {
+	var (
+		delay time.Duration
+		timer *time.Timer
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	delays := make(chan time.Duration, 1)
+	tick := func(_ interface{}) error {
+		delay, action := h.OnLoopTick(Loop{el})
+		delays <- delay
+		if action == Shutdown {
+			return errorx.ErrEngineShutdown
+		}
+		return nil
+	}
+	for {
+		if err := el.poller.Trigger(queue.LowPriority, tick, nil); err != nil {
+			el.getLogger().Errorf("failed to enqueue the ticker of event-loop(%d): %v", el.idx, err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			el.getLogger().Debugf("stopping ticker of event-loop(%d) from Engine, error:%v", el.idx, ctx.Err())
+			return
+		case delay = <-delays:
+		}
+		if timer == nil {
+			timer = time.NewTimer(delay)
+		} else {
+			timer.Reset(delay)
+		}
+		select {
+		case <-ctx.Done():
+			el.getLogger().Debugf("stopping ticker of event-loop(%d) from Engine, error:%v", el.idx, ctx.Err())
+			return
+		case <-timer.C:
+		}
+	}
+}
+
 func (el *eventloop) handleAction(c *conn, action Action) error {
 	switch action {
 	case None:
 		return nil
 	case Close:
-		return el.close(c, nil)
+		return el.close(c, errorx.ErrHandlerClosed)
 	case Shutdown:
 		return errorx.ErrEngineShutdown
 	default:
@@ -287,6 +585,7 @@ func (el *eventloop) handleAction(c *conn, action Action) error {
 }
 
 func (el *eventloop) readUDP1(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) error {
+	el.renewBuffer()
 	n, sa, err := unix.Recvfrom(fd, el.buffer, 0)
 	if err != nil {
 		if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
@@ -297,6 +596,9 @@ func (el *eventloop) readUDP1(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) erro
 	}
 	var c *conn
 	if fd == el.ln.fd {
+		if !el.engine.permit(socket.SockaddrToIP(sa)) {
+			return nil // drop the packet from the denied source
+		}
 		c = newUDPConn(fd, el, el.ln.addr, sa, false)
 	} else {
 		c = el.connections.getConn(fd)
@@ -305,6 +607,8 @@ func (el *eventloop) readUDP1(fd int, _ netpoll.IOEvent, _ netpoll.IOFlags) erro
 	action := el.eventHandler.OnTraffic(c)
 	if c.peer != nil {
 		c.release()
+	} else {
+		c.buffer = c.buffer[:0]
 	}
 	if action == Shutdown {
 		return errorx.ErrEngineShutdown
@@ -22,18 +22,23 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 	"github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
 )
 
 type eventloop struct {
-	ch           chan interface{}   // channel for event-loop
-	idx          int                // index of event-loop in event-loops
-	eng          *engine            // engine in loop
-	cache        bytes.Buffer       // temporary buffer for scattered bytes
-	connCount    int32              // number of active connections in event-loop
-	connections  map[*conn]struct{} // TCP connection map: fd -> conn
-	eventHandler EventHandler       // user eventHandler
+	ch           chan interface{}          // channel for event-loop
+	idx          int                       // index of event-loop in event-loops
+	eng          *engine                   // engine in loop
+	cache        bytes.Buffer              // temporary buffer for scattered bytes
+	vecs         [][]byte                  // segments of inbound data returned by Conn.PeekV and Conn.NextV
+	alloc        allocator.BufferAllocator // allocator of the buffers of connections, nil for the built-in pools
+	connCount    int32                     // number of active connections in event-loop
+	connections  map[*conn]struct{}        // TCP connection map: fd -> conn
+	futures      pendingFutures            // futures of the tasks queued up in the loop
+	ctx          interface{}               // user-defined context
+	eventHandler EventHandler              // user eventHandler
 }
 
 func (el *eventloop) getLogger() logging.Logger {
@@ -48,12 +53,27 @@ func (el *eventloop) countConn() int32 {
 	return atomic.LoadInt32(&el.connCount)
 }
 
+// countAssigned is always zero as the accepted connections are not handed off in batches on Windows.
+func (el *eventloop) countAssigned() int32 {
+	return 0
+}
+
+// memoryUsage is always zero as the memory held in buffers is not tracked on Windows.
+func (el *eventloop) memoryUsage() (inbound, outbound int64) {
+	return 0, 0
+}
+
+func (el *eventloop) countPendingTasks() int {
+	return len(el.ch)
+}
+
 func (el *eventloop) run() (err error) {
 	defer func() {
 		el.eng.shutdown(err)
 		for c := range el.connections {
-			_ = el.close(c, nil)
+			_ = el.close(c, errors.ErrEngineShutdown)
 		}
+		el.onLoopStop()
 	}()
 
 	if el.eng.opts.LockOSThread {
@@ -61,12 +81,14 @@ func (el *eventloop) run() (err error) {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	for i := range el.ch {
 		switch v := i.(type) {
 		case error:
 			err = v
 		case *netErr:
-			err = el.close(v.c, v.err)
+			err = el.close(v.c, netCloseReason(v.err))
 		case *openConn:
 			err = el.open(v)
 		case *tcpConn:
@@ -100,7 +122,18 @@ func (el *eventloop) open(oc *openConn) error {
 		el.connections[c] = struct{}{}
 		el.incConn(1)
 	}
+	if c.proxyPending {
+		// Defer OnOpen until the PROXY protocol header is received.
+		c.proxyTimer = time.AfterFunc(el.eng.opts.ProxyProtocolTimeout, func() {
+			el.ch <- func() error { return el.proxyTimeout(c) }
+		})
+		return nil
+	}
 
+	return el.fireOpen(c)
+}
+
+func (el *eventloop) fireOpen(c *conn) error {
 	out, action := el.eventHandler.OnOpen(c)
 	if out != nil {
 		if _, err := c.rawConn.Write(out); err != nil {
@@ -108,6 +141,10 @@ func (el *eventloop) open(oc *openConn) error {
 		}
 	}
 
+	if action == None && el.eng.isDraining() {
+		// The connection was accepted right before the engine started draining.
+		action = el.onDrain(c)
+	}
 	return el.handleAction(c, action)
 }
 
@@ -115,20 +152,70 @@ func (el *eventloop) read(c *conn) error {
 	if _, ok := el.connections[c]; !ok {
 		return nil // ignore stale wakes.
 	}
+	if c.proxyPending {
+		if ok, err := el.readProxyHeader(c); !ok {
+			return err
+		}
+	}
 	action := el.eventHandler.OnTraffic(c)
 	switch action {
 	case None:
 	case Close:
-		return el.close(c, nil)
+		return el.close(c, errors.ErrHandlerClosed)
 	case Shutdown:
 		return errors.ErrEngineShutdown
 	}
 	_, _ = c.inboundBuffer.Write(c.buffer.B)
+	c.releaseInbound()
 	c.buffer.Reset()
 
 	return nil
 }
 
+// readProxyHeader tries to consume the PROXY protocol header from the inbound data and fires OnOpen
+// once it's done, it reports whether there is leftover data for OnTraffic.
+func (el *eventloop) readProxyHeader(c *conn) (bool, error) {
+	ok, err := c.parseProxyHeader(el.eng.opts.ProxyProtocol)
+	if err != nil {
+		return false, el.close(c, err)
+	}
+	if !ok {
+		_, _ = c.inboundBuffer.Write(c.buffer.B)
+		c.buffer.Reset()
+		return false, nil
+	}
+
+	c.proxyPending = false
+	c.proxyTimer.Stop()
+	if err = el.fireOpen(c); err != nil {
+		return false, err
+	}
+	if _, ok = el.connections[c]; !ok {
+		return false, nil
+	}
+	return c.InboundBuffered() > 0, nil
+}
+
+// proxyTimeout fires when the PROXY protocol header is not received in time.
+func (el *eventloop) proxyTimeout(c *conn) error {
+	if _, ok := el.connections[c]; !ok || !c.proxyPending {
+		return nil // ignore stale connections
+	}
+
+	if el.eng.opts.ProxyProtocol == ProxyProtocolRequired {
+		return el.close(c, errors.ErrProxyHeaderTimeout)
+	}
+	// Serve the connection without header, the partial data which looks like a header is kept.
+	c.proxyPending = false
+	if err := el.fireOpen(c); err != nil {
+		return err
+	}
+	if c.InboundBuffered() > 0 {
+		return el.wake(c)
+	}
+	return nil
+}
+
 func (el *eventloop) readUDP(c *conn) error {
 	action := el.eventHandler.OnTraffic(c)
 	if action == Shutdown {
@@ -138,6 +225,24 @@ func (el *eventloop) readUDP(c *conn) error {
 	return nil
 }
 
+// submit sends the task to the event-loop, the priority is ignored as all events
+// share the same channel on Windows.
+func (el *eventloop) submit(_ TaskPriority, fn func()) error {
+	if el.eng.workerPool.shutdownCtx.Err() != nil || el.futures.isStopped() {
+		return errors.ErrEngineShutdown
+	}
+	// The event-loop may exit while the channel is full, don't wait for it forever.
+	select {
+	case el.ch <- func() error {
+		fn()
+		return nil
+	}:
+		return nil
+	case <-el.eng.workerPool.shutdownCtx.Done():
+		return errors.ErrEngineShutdown
+	}
+}
+
 func (el *eventloop) ticker(ctx context.Context) {
 	if el == nil {
 		return
@@ -178,11 +283,59 @@ func (el *eventloop) ticker(ctx context.Context) {
 	}
 }
 
+// loopTicker runs h.OnLoopTick on the goroutine of el periodically until ctx is done.
+func (el *eventloop) loopTicker(ctx context.Context, h LoopTickHandler) {
+	var (
+		delay time.Duration
+		timer *time.Timer
+	)
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	delays := make(chan time.Duration, 1)
+	tick := func() error {
+		delay, action := h.OnLoopTick(Loop{el})
+		delays <- delay
+		if action == Shutdown {
+			return errors.ErrEngineShutdown
+		}
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			el.getLogger().Debugf("stopping ticker of event-loop(%d) from Server, error:%v", el.idx, ctx.Err())
+			return
+		case el.ch <- tick:
+		}
+		select {
+		case <-ctx.Done():
+			el.getLogger().Debugf("stopping ticker of event-loop(%d) from Server, error:%v", el.idx, ctx.Err())
+			return
+		case delay = <-delays:
+		}
+		if timer == nil {
+			timer = time.NewTimer(delay)
+		} else {
+			timer.Reset(delay)
+		}
+		select {
+		case <-ctx.Done():
+			el.getLogger().Debugf("stopping ticker of event-loop(%d) from Server, error:%v", el.idx, ctx.Err())
+			return
+		case <-timer.C:
+		}
+	}
+}
+
 func (el *eventloop) wake(c *conn) error {
 	if _, ok := el.connections[c]; !ok {
 		return nil // ignore stale wakes.
 	}
 	action := el.eventHandler.OnTraffic(c)
+	c.releaseInbound()
 	return el.handleAction(c, action)
 }
 
@@ -204,7 +357,14 @@ func (el *eventloop) close(c *conn, err error) error {
 
 	delete(el.connections, c)
 	el.incConn(-1)
-	action := el.eventHandler.OnClose(c, err)
+	if c.admitted {
+		el.eng.admission.leave(c.remoteAddr)
+	}
+	var action Action
+	// OnClose doesn't fire if OnOpen didn't fire due to the absence of PROXY protocol header.
+	if !c.proxyPending {
+		action = el.eventHandler.OnClose(c, err)
+	}
 	if err := c.rawConn.Close(); err != nil {
 		el.getLogger().Errorf("failed to close connection(%s), error:%v", c.remoteAddr.String(), err)
 	}
@@ -218,7 +378,7 @@ func (el *eventloop) handleAction(c *conn, action Action) error {
 	case None:
 		return nil
 	case Close:
-		return el.close(c, nil)
+		return el.close(c, errors.ErrHandlerClosed)
 	case Shutdown:
 		return errors.ErrEngineShutdown
 	default:
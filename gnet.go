@@ -26,6 +26,7 @@ import (
 	"github.com/panjf2000/gnet/v2/pkg/buffer/ring"
 	"github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 // Action is an action that occurs after the completion of an event.
@@ -90,21 +91,37 @@ func (e Engine) Dup() (fd int, err error) {
 
 // Stop gracefully shuts down this Engine without interrupting any active event-loops,
 // it waits indefinitely for connections and event-loops to be closed and then shuts down.
+//
+// With WithGracefulDrain, Stop stops accepting new connections, fires OnDrain on each connection
+// and waits for them to be closed by either side until ctx is done before shutting down, the
+// connections remaining by then are closed forcibly, Stop still waits for the engine to be shut down
+// in that case and returns the error of ctx afterwards.
 func (e Engine) Stop(ctx context.Context) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
 
+	var drainErr error
+	if e.eng.opts.GracefulDrain {
+		drainErr = e.eng.drain(ctx)
+	}
 	e.eng.shutdown(nil)
 
+	// ctx is done if draining is interrupted by it, don't give up waiting for
+	// the remaining connections to be closed forcibly.
+	done := ctx.Done()
+	if drainErr != nil {
+		done = nil
+	}
+
 	ticker := time.NewTicker(shutdownPollInterval)
 	defer ticker.Stop()
 	for {
 		if e.eng.isInShutdown() {
-			return nil
+			return drainErr
 		}
 		select {
-		case <-ctx.Done():
+		case <-done:
 			return ctx.Err()
 		case <-ticker.C:
 		}
@@ -181,9 +198,16 @@ type Reader interface {
 	// Note that the []byte buf returned by Next() is not allowed to be passed to a new goroutine,
 	// as this []byte will be reused within event-loop.
 	// If you have to use buf in a new goroutine, then you need to make a copy of buf and pass this copy
-	// to that new goroutine.
+	// to that new goroutine, or use NextRetained instead.
 	Next(n int) (buf []byte, err error)
 
+	// NextRetained is like Next but returns a reference-counted buffer that remains valid after OnTraffic
+	// returns until it's released, which allows the data to be passed to a new goroutine without copying
+	// as long as it's in the read buffer of event-loop, otherwise it's copied into a buffer from the pool.
+	//
+	// The caller must call RetainedBuffer.Release once it's done with the buffer.
+	NextRetained(n int) (buf *RetainedBuffer, err error)
+
 	// Peek returns the next n bytes without advancing the reader. The bytes stop
 	// being valid at the next read call. If Peek returns fewer than n bytes, it
 	// also returns an error explaining why the read is short. The error is
@@ -195,6 +219,21 @@ type Reader interface {
 	// to that new goroutine.
 	Peek(n int) (buf []byte, err error)
 
+	// PeekV is like Peek but returns the bytes as the segments of the underlying buffers without
+	// copying them, which saves merging the data that spans multiple buffers into a single slice.
+	// The segments stop being valid at the next read call, and the [][]byte itself is reused by
+	// the next call of PeekV or NextV.
+	//
+	// Note that the segments returned by PeekV() are not allowed to be passed to a new goroutine.
+	PeekV(n int) (bs [][]byte, err error)
+
+	// NextV is like Next but returns the bytes as the segments of the underlying buffers without
+	// copying them. The segments remain valid until OnTraffic returns or the next read call,
+	// and the [][]byte itself is reused by the next call of PeekV or NextV.
+	//
+	// Note that the segments returned by NextV() are not allowed to be passed to a new goroutine.
+	NextV(n int) (bs [][]byte, err error)
+
 	// Discard skips the next n bytes, returning the number of bytes discarded.
 	//
 	// If Discard skips fewer than n bytes, it also returns an error.
@@ -204,6 +243,13 @@ type Reader interface {
 
 	// InboundBuffered returns the number of bytes that can be read from the current buffer.
 	InboundBuffered() (n int)
+
+	// ReadFDs returns the file descriptors received from the peer as SCM_RIGHTS ancillary data
+	// over a unix domain socket since the last call, the ownership of file descriptors is transferred
+	// to the caller who is responsible for closing them. The file descriptors arrive along with the
+	// bytes that are about to be read from the buffer, those that are not taken are closed along
+	// with the connection.
+	ReadFDs() (fds []int)
 }
 
 // Writer is an interface that consists of a number of methods for writing that Conn must implement.
@@ -223,6 +269,14 @@ type Writer interface {
 	// it's not goroutine-safe, you must invoke it within any method in EventHandler.
 	OutboundBuffered() (n int)
 
+	// WriteWithFDs writes p along with the file descriptors as SCM_RIGHTS ancillary data to the peer
+	// over a unix domain socket, it's not goroutine-safe, you must invoke it within any method in EventHandler.
+	// The file descriptors are duplicated into the peer and remain open on this side.
+	//
+	// p must not be empty and the pending data in outbound buffer must be flushed in advance,
+	// otherwise ErrPendingOutbound is returned and nothing is sent.
+	WriteWithFDs(p []byte, fds []int) (n int, err error)
+
 	// AsyncWrite writes bytes to peer asynchronously, it's goroutine-safe,
 	// you don't have to invoke it within any method in EventHandler,
 	// usually you would call it in an individual goroutine.
@@ -296,10 +350,22 @@ type Socket interface {
 	// algorithm).
 	// The default is true (no delay), meaning that data is sent as soon as possible after a Write.
 	SetNoDelay(noDelay bool) error
+
+	// PeerCredentials returns the credentials of the process on the other side of a unix domain socket
+	// at the time it connected, it's supported on Linux (SO_PEERCRED), darwin and FreeBSD (LOCAL_PEERCRED)
+	// and PID is always 0 on FreeBSD. It returns errors.ErrUnsupportedOp on the other platforms.
+	PeerCredentials() (cred *Credentials, err error)
 	// CloseRead() error
 	// CloseWrite() error
 }
 
+// Credentials is the identity of the process on the other side of a unix domain socket.
+type Credentials struct {
+	PID int // process ID
+	UID int // user ID
+	GID int // group ID
+}
+
 // Conn is an interface of underlying connection.
 type Conn interface {
 	Reader // all methods in Reader are not goroutine-safe.
@@ -322,6 +388,17 @@ type Conn interface {
 	// you must invoke it within any method in EventHandler.
 	RemoteAddr() (addr net.Addr)
 
+	// ProxyHeader returns the PROXY protocol header received from the peer, or nil if there is none,
+	// see Options.ProxyProtocol. LocalAddr and RemoteAddr return the addresses carried by the header
+	// when it's present. It's not goroutine-safe, you must invoke it within any method in EventHandler.
+	ProxyHeader() (hdr *proxyproto.Header)
+
+	// Loop returns the event-loop that the connection belongs to, it's goroutine-safe.
+	Loop() (loop Loop)
+
+	// LoopIndex returns the index of event-loop that the connection belongs to, it's goroutine-safe.
+	LoopIndex() (idx int)
+
 	// Wake triggers a OnTraffic event for the current connection, it's goroutine-safe.
 	Wake(callback AsyncCallback) (err error)
 
@@ -364,7 +441,11 @@ type (
 		OnOpen(c Conn) (out []byte, action Action)
 
 		// OnClose fires when a connection has been closed.
-		// The parameter err is the last known connection error.
+		// The parameter err tells why the connection was closed, use errors.Is to match it against
+		// the reasons in pkg/errors: ErrPeerClosed, ErrPeerReset, ErrLocalClosed, ErrHandlerClosed,
+		// ErrWriteFailed and ErrEngineShutdown, otherwise it's the last known connection error.
+		// ErrWriteFailed is never reported on Windows, where the data is written synchronously
+		// and the error of writing is returned to the caller instead.
 		OnClose(c Conn, err error) (action Action)
 
 		// OnTraffic fires when a socket receives data from the peer.
@@ -373,6 +454,10 @@ type (
 		// as this []byte will be reused within event-loop after OnTraffic() returns.
 		// If you have to use this []byte in a new goroutine, you should either make a copy of it or call Conn.Read([]byte)
 		// to read data into your own []byte, then pass the new []byte to the new goroutine.
+		// Alternatively, Conn.NextRetained(int) hands out the data that can outlive OnTraffic.
+		//
+		// For the message-oriented protocols: udp, unixgram and unixpacket, OnTraffic fires once per message
+		// and the part of message that is not read in OnTraffic is discarded.
 		OnTraffic(c Conn) (action Action)
 
 		// OnTick fires immediately after the engine starts and will fire again
@@ -380,6 +465,43 @@ type (
 		OnTick() (delay time.Duration, action Action)
 	}
 
+	// RejectHandler is an optional interface that EventHandler can implement to get notified
+	// of the connections rejected by the admission control of engine, see Options.MaxConnections,
+	// Options.MaxConnectionsPerIP and Options.AcceptRate.
+	RejectHandler interface {
+		// OnReject fires after a new connection has been rejected and closed,
+		// it is invoked on the goroutine that accepts connections.
+		OnReject(remoteAddr net.Addr, reason RejectReason)
+	}
+
+	// DrainHandler is an optional interface that EventHandler can implement to get notified
+	// when the engine starts draining, see WithGracefulDrain.
+	DrainHandler interface {
+		// OnDrain fires on each connection once the engine stops accepting new connections during
+		// a graceful shutdown, it's the place to tell the peer to go away, e.g. sending a GOAWAY frame.
+		OnDrain(c Conn) (action Action)
+	}
+
+	// LoopTickHandler is an optional interface that EventHandler can implement to run
+	// periodic work on each event-loop, it takes effect with WithLoopTicker.
+	LoopTickHandler interface {
+		// OnLoopTick fires on the goroutine of each event-loop immediately after the event-loop starts
+		// and will fire again following the duration specified by the delay return value, it's safe
+		// to access the connections of the event-loop within it.
+		OnLoopTick(loop LoopInfo) (delay time.Duration, action Action)
+	}
+
+	// LoopHandler is an optional interface that EventHandler can implement to get notified
+	// of the lifecycle of event-loops, which is where the per-loop state can be set up and torn down,
+	// see LoopInfo.SetContext.
+	LoopHandler interface {
+		// OnLoopStart fires on the goroutine of an event-loop before it starts to serve connections.
+		OnLoopStart(loop LoopInfo)
+
+		// OnLoopStop fires on the goroutine of an event-loop after all of its connections are closed.
+		OnLoopStop(loop LoopInfo)
+	}
+
 	// BuiltinEventEngine is a built-in implementation of EventHandler which sets up each method with a default implementation,
 	// you can compose it with your own implementation of EventHandler when you don't want to implement all methods
 	// in EventHandler.
@@ -420,6 +542,30 @@ func (*BuiltinEventEngine) OnTick() (delay time.Duration, action Action) {
 	return
 }
 
+// OnDrain fires on each connection once the engine stops accepting new connections during
+// a graceful shutdown.
+func (*BuiltinEventEngine) OnDrain(_ Conn) (action Action) {
+	return
+}
+
+// OnLoopTick fires on the goroutine of each event-loop immediately after the event-loop starts
+// and will fire again following the duration specified by the delay return value.
+func (*BuiltinEventEngine) OnLoopTick(_ LoopInfo) (delay time.Duration, action Action) {
+	return
+}
+
+// OnLoopStart fires on the goroutine of an event-loop before it starts to serve connections.
+func (*BuiltinEventEngine) OnLoopStart(_ LoopInfo) {
+}
+
+// OnLoopStop fires on the goroutine of an event-loop after all of its connections are closed.
+func (*BuiltinEventEngine) OnLoopStop(_ LoopInfo) {
+}
+
+// OnReject fires after a new connection has been rejected and closed.
+func (*BuiltinEventEngine) OnReject(_ net.Addr, _ RejectReason) {
+}
+
 // MaxStreamBufferCap is the default buffer size for each stream-oriented connection(TCP/Unix).
 var MaxStreamBufferCap = 64 * 1024 // 64KB
 
@@ -429,15 +575,23 @@ var MaxStreamBufferCap = 64 * 1024 // 64KB
 // like `tcp://192.168.0.10:9851` or `unix://socket`.
 // Valid network schemes:
 //
-//	tcp   - bind to both IPv4 and IPv6
-//	tcp4  - IPv4
-//	tcp6  - IPv6
-//	udp   - bind to both IPv4 and IPv6
-//	udp4  - IPv4
-//	udp6  - IPv6
-//	unix  - Unix Domain Socket
+//	tcp        - bind to both IPv4 and IPv6
+//	tcp4       - IPv4
+//	tcp6       - IPv6
+//	udp        - bind to both IPv4 and IPv6
+//	udp4       - IPv4
+//	udp6       - IPv6
+//	unix       - Unix Domain Socket
+//	unixgram   - Unix Domain Socket of datagram
+//	unixpacket - Unix Domain Socket of sequenced packet
+//
+// The address of Unix Domain Socket starting with '@' like `unix://@socket` refers to
+// the abstract namespace on Linux, which has no presence in the filesystem.
 //
 // The "tcp" network scheme is assumed when one is not specified.
+//
+// Run fails with errors.ErrUnsupportedOp if any of the Linux-specific socket options,
+// e.g. TCPFastOpen or TCPQuickAck, is set on the other platforms.
 func Run(eventHandler EventHandler, protoAddr string, opts ...Option) (err error) {
 	options := loadOptions(opts...)
 
@@ -465,6 +619,10 @@ func Run(eventHandler EventHandler, protoAddr string, opts ...Option) (err error
 		return errors.ErrTooManyEventLoopThreads
 	}
 
+	if err = checkSockOpts(options); err != nil {
+		return
+	}
+
 	rbc := options.ReadBufferCap
 	switch {
 	case rbc <= 0:
@@ -484,6 +642,10 @@ func Run(eventHandler EventHandler, protoAddr string, opts ...Option) (err error
 		options.WriteBufferCap = math.CeilToPowerOfTwo(wbc)
 	}
 
+	if options.ProxyProtocol != ProxyProtocolDisabled && options.ProxyProtocolTimeout <= 0 {
+		options.ProxyProtocolTimeout = DefaultProxyProtocolTimeout
+	}
+
 	network, addr := parseProtoAddr(protoAddr)
 
 	var ln *listener
@@ -500,6 +662,9 @@ var (
 
 	// shutdownPollInterval is how often we poll to check whether engine has been shut down during gnet.Stop().
 	shutdownPollInterval = 500 * time.Millisecond
+
+	// drainPollInterval is how often we poll to check whether all connections have been closed during draining.
+	drainPollInterval = 10 * time.Millisecond
 )
 
 // Stop gracefully shuts down the engine without interrupting any active event-loops,
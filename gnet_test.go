@@ -6,10 +6,13 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"net"
 	"runtime"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -23,6 +26,7 @@ import (
 	"github.com/panjf2000/gnet/v2/pkg/logging"
 	bbPool "github.com/panjf2000/gnet/v2/pkg/pool/bytebuffer"
 	goPool "github.com/panjf2000/gnet/v2/pkg/pool/goroutine"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
 )
 
 var (
@@ -929,6 +933,908 @@ func TestServerOptionsCheck(t *testing.T) {
 	assert.EqualError(t, err, errorx.ErrTooManyEventLoopThreads.Error(), "error returned with LockOSThread option")
 }
 
+// scenarioServer is the base of the test servers driven by a client scenario, the scenario
+// runs on the first tick of engine and the engine is shut down after the scenario returns.
+type scenarioServer struct {
+	*BuiltinEventEngine
+	tester        *testing.T
+	eng           Engine
+	network, addr string
+	scenario      func()
+	async         bool // run the scenario off the ticker and stop the engine with Engine.Stop
+	started       bool
+}
+
+func (s *scenarioServer) OnBoot(eng Engine) (action Action) {
+	s.eng = eng
+	return
+}
+
+func (s *scenarioServer) OnTick() (delay time.Duration, action Action) {
+	delay = 100 * time.Millisecond
+	if s.started {
+		if !s.async {
+			action = Shutdown
+		}
+		return
+	}
+	s.started = true
+	if !s.async {
+		s.scenario()
+		return
+	}
+	go func() {
+		defer func() {
+			// The scenario may have stopped the engine on its own.
+			if err := s.eng.Stop(context.Background()); !errors.Is(err, errorx.ErrEngineInShutdown) {
+				assert.NoError(s.tester, err)
+			}
+		}()
+		s.scenario()
+	}()
+	return
+}
+
+func TestCustomLoadBalancer(t *testing.T) {
+	testCustomLoadBalancer(t, "tcp", ":9971")
+}
+
+// lastLoopLoadBalancer always picks the last event-loop by relying on the index being wrapped around.
+type lastLoopLoadBalancer struct {
+	loops int32
+	calls int32
+}
+
+func (lb *lastLoopLoadBalancer) Next(_ net.Addr, loops []LoopStats) int {
+	atomic.StoreInt32(&lb.loops, int32(len(loops)))
+	atomic.AddInt32(&lb.calls, 1)
+	return -1
+}
+
+type testCustomLoadBalancerServer struct {
+	scenarioServer
+	nclients int32
+	opened   int32
+}
+
+func (s *testCustomLoadBalancerServer) OnOpen(c Conn) (out []byte, action Action) {
+	assert.Equal(s.tester, 3, c.(*conn).loop.idx, "connection should be assigned to the last event-loop")
+	atomic.AddInt32(&s.opened, 1)
+	return
+}
+
+func (s *testCustomLoadBalancerServer) run() {
+	for i := int32(0); i < s.nclients; i++ {
+		c, err := net.Dial(s.network, s.addr)
+		require.NoError(s.tester, err)
+		defer c.Close() //nolint:errcheck
+	}
+	for atomic.LoadInt32(&s.opened) < s.nclients {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testCustomLoadBalancer(t *testing.T, network, addr string) {
+	lb := new(lastLoopLoadBalancer)
+	svr := &testCustomLoadBalancerServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr}, nclients: 5}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithNumEventLoop(4),
+		WithLoadBalancing(LeastConnections),
+		WithLoadBalancer(lb))
+	assert.NoError(t, err)
+	assert.EqualValues(t, svr.nclients, atomic.LoadInt32(&svr.opened))
+	assert.EqualValues(t, svr.nclients, atomic.LoadInt32(&lb.calls))
+	assert.EqualValues(t, 4, atomic.LoadInt32(&lb.loops))
+}
+
+func TestAdmissionControl(t *testing.T) {
+	t.Run("max-connections", func(t *testing.T) {
+		testAdmissionControl(t, "tcp", ":9976", RejectMaxConnections, WithMaxConnections(2))
+	})
+	t.Run("max-connections-per-ip", func(t *testing.T) {
+		testAdmissionControl(t, "tcp", ":9977", RejectMaxConnectionsPerIP, WithMaxConnectionsPerIP(2))
+	})
+	t.Run("accept-rate", func(t *testing.T) {
+		// The burst defaults to the rate, one token is generated every half second.
+		testAdmissionControl(t, "tcp", ":9946", RejectAcceptRate, WithAcceptRate(2, 0))
+	})
+}
+
+func TestAcceptRateLimiter(t *testing.T) {
+	ad := newAdmission(&Options{AcceptRate: 2, AcceptBurst: 3})
+	now := ad.limiter.last
+	for i := 0; i < 3; i++ {
+		assert.True(t, ad.limiter.take(now))
+	}
+	assert.False(t, ad.limiter.take(now), "the burst should be exhausted")
+	assert.False(t, ad.limiter.take(now.Add(400*time.Millisecond)))
+	assert.True(t, ad.limiter.take(now.Add(600*time.Millisecond)), "a token should be generated in half a second")
+	assert.False(t, ad.limiter.take(now.Add(600*time.Millisecond)))
+
+	// The tokens never exceed the burst.
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, ad.limiter.take(now))
+	}
+	assert.False(t, ad.limiter.take(now))
+}
+
+type testAdmissionServer struct {
+	scenarioServer
+	reason   RejectReason
+	admitted int32
+	rejected int32
+	opened   int32
+}
+
+func (s *testAdmissionServer) OnOpen(Conn) (out []byte, action Action) {
+	atomic.AddInt32(&s.opened, 1)
+	return
+}
+
+func (s *testAdmissionServer) OnReject(remoteAddr net.Addr, reason RejectReason) {
+	assert.NotNil(s.tester, remoteAddr)
+	assert.Equal(s.tester, s.reason, reason)
+	atomic.AddInt32(&s.rejected, 1)
+}
+
+func (s *testAdmissionServer) run() {
+	for i := int32(0); i < s.admitted; i++ {
+		c, err := net.Dial(s.network, s.addr)
+		require.NoError(s.tester, err)
+		defer c.Close() //nolint:errcheck
+	}
+	for atomic.LoadInt32(&s.opened) < s.admitted {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		c, err := net.Dial(s.network, s.addr)
+		require.NoError(s.tester, err)
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b, err := io.ReadAll(c)
+		assert.NoError(s.tester, err)
+		assert.Equal(s.tester, "bye", string(b), "rejected connection should receive the goodbye payload")
+		_ = c.Close()
+	}
+}
+
+func testAdmissionControl(t *testing.T, network, addr string, reason RejectReason, opt Option) {
+	svr := &testAdmissionServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr}, reason: reason, admitted: 2}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithMulticore(true),
+		WithReuseAddr(true), // rejected connections are closed by server, leaving TIME_WAIT behind
+		WithRejectPayload([]byte("bye")),
+		opt)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&svr.opened))
+	assert.EqualValues(t, 3, atomic.LoadInt32(&svr.rejected))
+}
+
+func TestAccessControl(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testAccessControl(t, "tcp", ":9978")
+	})
+	t.Run("udp", func(t *testing.T) {
+		testAccessControl(t, "udp", ":9979")
+	})
+	t.Run("invalid-cidr", func(t *testing.T) {
+		err := Run(&BuiltinEventEngine{}, "tcp://:9978", WithDeniedCIDRs("127.0.0.1/33"))
+		assert.Error(t, err)
+	})
+}
+
+type testAccessControlServer struct {
+	scenarioServer
+	rejected int32
+	traffic  int32
+}
+
+func (s *testAccessControlServer) OnReject(_ net.Addr, reason RejectReason) {
+	assert.Equal(s.tester, RejectAccessDenied, reason)
+	atomic.AddInt32(&s.rejected, 1)
+}
+
+func (s *testAccessControlServer) OnTraffic(c Conn) (action Action) {
+	atomic.AddInt32(&s.traffic, 1)
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testAccessControlServer) run() {
+	// The loopback address is denied, nothing should reach OnTraffic.
+	c, err := net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	_, err = c.Write([]byte("denied"))
+	require.NoError(s.tester, err)
+	_ = c.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, err = c.Read(make([]byte, 64))
+	assert.Error(s.tester, err)
+	_ = c.Close()
+	assert.EqualValues(s.tester, 0, atomic.LoadInt32(&s.traffic))
+
+	// Only the loopback address is allowed after the hot reload.
+	require.NoError(s.tester, s.eng.UpdateAccessControl([]string{"127.0.0.0/8", "::1"}, nil))
+	assert.Error(s.tester, s.eng.UpdateAccessControl([]string{"localhost"}, nil))
+	c, err = net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	_, err = c.Write([]byte("allowed"))
+	require.NoError(s.tester, err)
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, err := c.Read(buf)
+	assert.NoError(s.tester, err)
+	assert.Equal(s.tester, "allowed", string(buf[:n]))
+	_ = c.Close()
+}
+
+func testAccessControl(t *testing.T, network, addr string) {
+	svr := &testAccessControlServer{scenarioServer: scenarioServer{tester: t, network: network, addr: "127.0.0.1" + addr, async: true}}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithReuseAddr(true),
+		WithAllowedCIDRs("0.0.0.0/0", "::/0"),
+		WithDeniedCIDRs("127.0.0.1"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&svr.traffic))
+	if network == "tcp" {
+		assert.EqualValues(t, 1, atomic.LoadInt32(&svr.rejected))
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	t.Run("required", func(t *testing.T) {
+		testProxyProtocol(t, "tcp", ":9980", ProxyProtocolRequired)
+	})
+	t.Run("optional", func(t *testing.T) {
+		testProxyProtocol(t, "tcp", ":9981", ProxyProtocolOptional)
+	})
+}
+
+type testProxyProtocolServer struct {
+	scenarioServer
+	mode   ProxyProtocolMode
+	opened int32
+	closed int32
+}
+
+func (s *testProxyProtocolServer) OnOpen(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&s.opened, 1)
+	if hdr := c.ProxyHeader(); hdr != nil {
+		assert.Equal(s.tester, "192.168.0.1:56324", c.RemoteAddr().String())
+		assert.Equal(s.tester, "192.168.0.11:443", c.LocalAddr().String())
+		if hdr.Version == 2 {
+			alpn, ok := hdr.TLV(proxyproto.TypeALPN)
+			assert.True(s.tester, ok)
+			assert.Equal(s.tester, "h2", string(alpn))
+		}
+	} else {
+		assert.True(s.tester, strings.HasPrefix(c.RemoteAddr().String(), "127.0.0.1:"))
+	}
+	return
+}
+
+func (s *testProxyProtocolServer) OnClose(Conn, error) (action Action) {
+	atomic.AddInt32(&s.closed, 1)
+	return
+}
+
+func (s *testProxyProtocolServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write([]byte(c.RemoteAddr().String() + " " + string(buf)))
+	return
+}
+
+// roundTrip sends the chunks one by one and returns the response from server.
+func (s *testProxyProtocolServer) roundTrip(chunks ...[]byte) (string, error) {
+	c, err := net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close()
+	for _, chunk := range chunks {
+		_, err = c.Write(chunk)
+		require.NoError(s.tester, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 128)
+	n, err := c.Read(buf)
+	return string(buf[:n]), err
+}
+
+func (s *testProxyProtocolServer) run() {
+	v1 := []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n")
+	resp, err := s.roundTrip(v1[:10], v1[10:], []byte("hello"))
+	assert.NoError(s.tester, err)
+	assert.Equal(s.tester, "192.168.0.1:56324 hello", resp)
+	resp, err = s.roundTrip(append(v1, "hello"...))
+	assert.NoError(s.tester, err)
+	assert.Equal(s.tester, "192.168.0.1:56324 hello", resp)
+
+	v2 := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x11" +
+		"\xc0\xa8\x00\x01\xc0\xa8\x00\x0b\xdc\x04\x01\xbb" +
+		"\x01\x00\x02h2")
+	resp, err = s.roundTrip(v2[:5], v2[5:], []byte("hello"))
+	assert.NoError(s.tester, err)
+	assert.Equal(s.tester, "192.168.0.1:56324 hello", resp)
+
+	resp, err = s.roundTrip([]byte("hello"))
+	if s.mode == ProxyProtocolRequired {
+		assert.Error(s.tester, err, "connection without header should be closed")
+	} else {
+		assert.NoError(s.tester, err)
+		assert.True(s.tester, strings.HasSuffix(resp, " hello"))
+	}
+
+	// Wait for the header until timeout.
+	resp, err = s.roundTrip([]byte("PROXY TCP4"))
+	if s.mode == ProxyProtocolRequired {
+		assert.Error(s.tester, err, "connection without header should be closed after timeout")
+	} else {
+		assert.NoError(s.tester, err)
+		assert.True(s.tester, strings.HasSuffix(resp, " PROXY TCP4"))
+	}
+}
+
+func testProxyProtocol(t *testing.T, network, addr string, mode ProxyProtocolMode) {
+	svr := &testProxyProtocolServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr, async: true}, mode: mode}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithReuseAddr(true),
+		WithProxyProtocol(mode),
+		WithProxyProtocolTimeout(200*time.Millisecond))
+	assert.NoError(t, err)
+	if mode == ProxyProtocolRequired {
+		assert.EqualValues(t, 3, atomic.LoadInt32(&svr.opened))
+	} else {
+		assert.EqualValues(t, 5, atomic.LoadInt32(&svr.opened))
+	}
+	assert.EqualValues(t, atomic.LoadInt32(&svr.opened), atomic.LoadInt32(&svr.closed))
+}
+
+func TestLoopExecutor(t *testing.T) {
+	testLoopExecutor(t, "tcp", ":9984")
+}
+
+type testLoopExecutorServer struct {
+	scenarioServer
+	shards []map[string]int // per-loop state without locks
+}
+
+func (s *testLoopExecutorServer) OnBoot(eng Engine) (action Action) {
+	s.eng = eng
+	_, err := eng.Loop(0)
+	assert.ErrorIs(s.tester, err, errorx.ErrInvalidLoopIndex, "event-loops are not available in OnBoot")
+	return
+}
+
+func (s *testLoopExecutorServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	s.shards[c.Loop().Index()][string(buf)]++
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testLoopExecutorServer) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	futures, err := s.eng.Broadcast(TaskPriorityLow, func() (interface{}, error) {
+		return len(s.shards), nil
+	})
+	require.NoError(s.tester, err)
+	assert.Len(s.tester, futures, len(s.shards))
+	for _, f := range futures {
+		n, err := f.Get(ctx)
+		assert.NoError(s.tester, err)
+		assert.Equal(s.tester, len(s.shards), n)
+	}
+
+	c, err := net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close()
+	_, err = c.Write([]byte("hello"))
+	require.NoError(s.tester, err)
+	_, err = c.Read(make([]byte, 5))
+	require.NoError(s.tester, err)
+
+	// Aggregate the per-loop state by running tasks on each event-loop.
+	total := 0
+	for i := range s.shards {
+		idx := i
+		n, err := s.eng.Execute(idx, TaskPriorityHigh, func() (interface{}, error) {
+			return s.shards[idx]["hello"], nil
+		}).Get(ctx)
+		assert.NoError(s.tester, err)
+		total += n.(int)
+	}
+	assert.Equal(s.tester, 1, total)
+
+	l, err := s.eng.Loop(1)
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, 1, l.Index())
+	done := make(chan error, 1)
+	errTask := errors.New("task error")
+	require.NoError(s.tester, l.Submit(TaskPriorityLow, func() (interface{}, error) {
+		return nil, errTask
+	}, func(_ interface{}, err error) {
+		done <- err
+	}))
+	select {
+	case err = <-done:
+		assert.ErrorIs(s.tester, err, errTask)
+	case <-ctx.Done():
+		s.tester.Error("callback of task is not invoked")
+	}
+
+	_, err = s.eng.Execute(len(s.shards), TaskPriorityLow, func() (interface{}, error) {
+		return nil, nil
+	}).Get(ctx)
+	assert.ErrorIs(s.tester, err, errorx.ErrInvalidLoopIndex)
+
+	// The tasks are refused once the engine is shutting down, and the futures
+	// left in the queue are done as the event-loops stop.
+	pending := newFuture()
+	require.True(s.tester, l.el.futures.add(pending))
+	require.NoError(s.tester, s.eng.Stop(context.Background()))
+	_, err = pending.Get(ctx)
+	assert.ErrorIs(s.tester, err, errorx.ErrEngineShutdown)
+	assert.ErrorIs(s.tester, l.Submit(TaskPriorityHigh, func() (interface{}, error) {
+		return nil, nil
+	}, nil), errorx.ErrEngineShutdown)
+	_, err = l.Execute(TaskPriorityHigh, func() (interface{}, error) {
+		return nil, nil
+	}).Get(ctx)
+	assert.ErrorIs(s.tester, err, errorx.ErrEngineShutdown)
+}
+
+func testLoopExecutor(t *testing.T, network, addr string) {
+	svr := &testLoopExecutorServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr, async: true}, shards: make([]map[string]int, 4)}
+	svr.scenario = svr.run
+	for i := range svr.shards {
+		svr.shards[i] = make(map[string]int)
+	}
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithNumEventLoop(len(svr.shards)))
+	assert.NoError(t, err)
+}
+
+func TestLoopLifecycle(t *testing.T) {
+	t.Run("reactors", func(t *testing.T) {
+		testLoopLifecycle(t, "tcp", ":9985", false)
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testLoopLifecycle(t, "tcp", ":9986", true)
+	})
+}
+
+type loopState struct {
+	idx    int
+	conns  int
+	closed bool
+}
+
+type testLoopLifecycleServer struct {
+	scenarioServer
+	mu      sync.Mutex
+	states  []*loopState
+	stopped int32
+}
+
+func (s *testLoopLifecycleServer) OnLoopStart(loop LoopInfo) {
+	assert.Nil(s.tester, loop.Context())
+	state := &loopState{idx: loop.Index()}
+	loop.SetContext(state)
+	s.mu.Lock()
+	s.states = append(s.states, state)
+	s.mu.Unlock()
+}
+
+func (s *testLoopLifecycleServer) OnLoopStop(loop LoopInfo) {
+	state, ok := loop.Context().(*loopState)
+	require.True(s.tester, ok)
+	assert.Equal(s.tester, loop.Index(), state.idx)
+	assert.Zero(s.tester, state.conns, "all connections must be closed before OnLoopStop")
+	state.closed = true
+	atomic.AddInt32(&s.stopped, 1)
+}
+
+func (s *testLoopLifecycleServer) OnOpen(c Conn) (out []byte, action Action) {
+	state := c.Loop().Context().(*loopState)
+	assert.Equal(s.tester, state.idx, c.LoopIndex())
+	state.conns++
+	return
+}
+
+func (s *testLoopLifecycleServer) OnClose(c Conn, _ error) (action Action) {
+	c.Loop().Context().(*loopState).conns--
+	return
+}
+
+func (s *testLoopLifecycleServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testLoopLifecycleServer) run() {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := net.Dial(s.network, s.addr)
+			require.NoError(s.tester, err)
+			_, err = c.Write([]byte("hello"))
+			require.NoError(s.tester, err)
+			_, err = c.Read(make([]byte, 5))
+			require.NoError(s.tester, err)
+			// Leave the connection open, it must be closed by the engine before OnLoopStop.
+		}()
+	}
+	wg.Wait()
+}
+
+func testLoopLifecycle(t *testing.T, network, addr string, reusePort bool) {
+	svr := &testLoopLifecycleServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr}}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithReusePort(reusePort),
+		WithReuseAddr(true),
+		WithNumEventLoop(4))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, atomic.LoadInt32(&svr.stopped))
+	require.Len(t, svr.states, 4)
+	seen := make(map[int]bool)
+	for _, state := range svr.states {
+		assert.True(t, state.closed)
+		seen[state.idx] = true
+	}
+	assert.Len(t, seen, 4)
+}
+
+func TestLoopTicker(t *testing.T) {
+	t.Run("reactors", func(t *testing.T) {
+		testLoopTicker(t, "tcp", ":9987", false)
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testLoopTicker(t, "tcp", ":9988", true)
+	})
+}
+
+type testLoopTickerServer struct {
+	scenarioServer
+	ticks []int32
+}
+
+func (s *testLoopTickerServer) OnLoopStart(loop LoopInfo) {
+	loop.SetContext(make(map[Conn]struct{}))
+}
+
+func (s *testLoopTickerServer) OnOpen(c Conn) (out []byte, action Action) {
+	c.Loop().Context().(map[Conn]struct{})[c] = struct{}{}
+	return
+}
+
+func (s *testLoopTickerServer) OnClose(c Conn, _ error) (action Action) {
+	delete(c.Loop().Context().(map[Conn]struct{}), c)
+	return
+}
+
+func (s *testLoopTickerServer) OnLoopTick(loop LoopInfo) (delay time.Duration, action Action) {
+	atomic.AddInt32(&s.ticks[loop.Index()], 1)
+	// The connections of the event-loop can be accessed without locks.
+	for c := range loop.Context().(map[Conn]struct{}) {
+		assert.Equal(s.tester, loop.Index(), c.LoopIndex())
+		_, err := c.Write([]byte("tick"))
+		assert.NoError(s.tester, err)
+	}
+	return 50 * time.Millisecond, None
+}
+
+func (s *testLoopTickerServer) run() {
+	var wg sync.WaitGroup
+	for i := 0; i < 2*len(s.ticks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := net.Dial(s.network, s.addr)
+			require.NoError(s.tester, err)
+			defer c.Close()
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(c, buf)
+			require.NoError(s.tester, err)
+			assert.Equal(s.tester, "tick", string(buf))
+		}()
+	}
+	wg.Wait()
+}
+
+func testLoopTicker(t *testing.T, network, addr string, reusePort bool) {
+	svr := &testLoopTickerServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr, async: true}, ticks: make([]int32, 4)}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithLoopTicker(true),
+		WithReusePort(reusePort),
+		WithNumEventLoop(len(svr.ticks)))
+	assert.NoError(t, err)
+	for i := range svr.ticks {
+		assert.Positive(t, atomic.LoadInt32(&svr.ticks[i]), "event-loop(%d) never ticked", i)
+	}
+}
+
+func TestGracefulDrain(t *testing.T) {
+	t.Run("closed-by-peer", func(t *testing.T) {
+		testGracefulDrain(t, "tcp", ":9970", false, false)
+	})
+	t.Run("deadline", func(t *testing.T) {
+		testGracefulDrain(t, "tcp", ":9969", true, true)
+	})
+}
+
+type testGracefulDrainServer struct {
+	scenarioServer
+	stubborn bool
+	drained  int32
+	closed   int32
+}
+
+func (s *testGracefulDrainServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testGracefulDrainServer) OnDrain(c Conn) (action Action) {
+	atomic.AddInt32(&s.drained, 1)
+	_, err := c.Write([]byte("bye"))
+	assert.NoError(s.tester, err)
+	return
+}
+
+func (s *testGracefulDrainServer) OnClose(Conn, error) (action Action) {
+	atomic.AddInt32(&s.closed, 1)
+	return
+}
+
+func (s *testGracefulDrainServer) run() {
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		c, err := net.Dial(s.network, s.addr)
+		require.NoError(s.tester, err)
+		_, err = c.Write([]byte("ping"))
+		require.NoError(s.tester, err)
+		_, err = io.ReadFull(c, make([]byte, 4))
+		require.NoError(s.tester, err)
+
+		wg.Add(1)
+		go func(i int, c net.Conn) {
+			defer wg.Done()
+			defer c.Close()
+			buf := make([]byte, 3)
+			_, err := io.ReadFull(c, buf)
+			require.NoError(s.tester, err)
+			assert.Equal(s.tester, "bye", string(buf))
+			if s.stubborn && i == 0 {
+				// Don't close the connection on our own, it must be closed by the engine.
+				_, err = c.Read(buf)
+				assert.Error(s.tester, err)
+			}
+		}(i, c)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	err := s.eng.Stop(ctx)
+	if s.stubborn {
+		assert.ErrorIs(s.tester, err, context.DeadlineExceeded)
+	} else {
+		assert.NoError(s.tester, err)
+		assert.Less(s.tester, int64(time.Since(start)), int64(time.Second))
+	}
+	// Stop returns after the engine is shut down, even if the deadline expired while draining.
+	assert.EqualValues(s.tester, n, atomic.LoadInt32(&s.closed))
+	wg.Wait()
+	assert.EqualValues(s.tester, n, atomic.LoadInt32(&s.drained))
+}
+
+func testGracefulDrain(t *testing.T, network, addr string, stubborn, reusePort bool) {
+	svr := &testGracefulDrainServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr, async: true}, stubborn: stubborn}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithGracefulDrain(true),
+		WithReusePort(reusePort),
+		WithReuseAddr(true),
+		WithNumEventLoop(4))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 8, atomic.LoadInt32(&svr.closed))
+}
+
+func TestPauseAccept(t *testing.T) {
+	t.Run("reactors", func(t *testing.T) {
+		testPauseAccept(t, "tcp", ":9968", false)
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testPauseAccept(t, "tcp", ":9967", true)
+	})
+}
+
+type testPauseAcceptServer struct {
+	scenarioServer
+	opened int32
+}
+
+func (s *testPauseAcceptServer) OnOpen(Conn) (out []byte, action Action) {
+	atomic.AddInt32(&s.opened, 1)
+	return
+}
+
+func (s *testPauseAcceptServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testPauseAcceptServer) run() {
+	echo := func(c net.Conn) error {
+		if _, err := c.Write([]byte("ping")); err != nil {
+			return err
+		}
+		_ = c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		_, err := io.ReadFull(c, make([]byte, 4))
+		return err
+	}
+
+	c1, err := net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	defer c1.Close()
+	require.NoError(s.tester, echo(c1))
+
+	require.NoError(s.tester, s.eng.PauseAccept())
+	require.NoError(s.tester, s.eng.PauseAccept())
+	time.Sleep(50 * time.Millisecond)
+
+	// The new connection sits in the backlog of listener while the existing one keeps running.
+	c2, err := net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	defer c2.Close()
+	var netErr net.Error
+	require.ErrorAs(s.tester, echo(c2), &netErr)
+	assert.True(s.tester, netErr.Timeout())
+	assert.EqualValues(s.tester, 1, atomic.LoadInt32(&s.opened))
+	require.NoError(s.tester, echo(c1))
+
+	require.NoError(s.tester, s.eng.ResumeAccept())
+	_ = c2.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(c2, make([]byte, 4))
+	require.NoError(s.tester, err)
+	assert.EqualValues(s.tester, 2, atomic.LoadInt32(&s.opened))
+}
+
+func testPauseAccept(t *testing.T, network, addr string, reusePort bool) {
+	svr := &testPauseAcceptServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr, async: true}}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithReusePort(reusePort),
+		WithNumEventLoop(4))
+	assert.NoError(t, err)
+}
+
+func TestAcceptBatch(t *testing.T) {
+	t.Run("reactors", func(t *testing.T) {
+		testAcceptBatch(t, "tcp", ":9966", false, RoundRobin, nil)
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testAcceptBatch(t, "tcp", ":9965", true, RoundRobin, nil)
+	})
+	t.Run("least-connections", func(t *testing.T) {
+		testAcceptBatch(t, "tcp", ":9948", false, LeastConnections, nil)
+	})
+	t.Run("custom", func(t *testing.T) {
+		testAcceptBatch(t, "tcp", ":9947", false, RoundRobin, fewestConnectionsLoadBalancer{})
+	})
+}
+
+// fewestConnectionsLoadBalancer picks the event-loop with the fewest connections.
+type fewestConnectionsLoadBalancer struct{}
+
+func (fewestConnectionsLoadBalancer) Next(_ net.Addr, loops []LoopStats) (idx int) {
+	for i, stats := range loops {
+		if stats.Connections < loops[idx].Connections {
+			idx = i
+		}
+	}
+	return
+}
+
+type testAcceptBatchServer struct {
+	scenarioServer
+	spread bool
+	opened int32
+	loops  [4]int32
+}
+
+func (s *testAcceptBatchServer) OnOpen(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&s.opened, 1)
+	atomic.AddInt32(&s.loops[c.LoopIndex()], 1)
+	return
+}
+
+func (s *testAcceptBatchServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testAcceptBatchServer) run() {
+	const n = 64
+	var wg, done sync.WaitGroup
+	done.Add(1)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			c, err := net.Dial(s.network, s.addr)
+			require.NoError(s.tester, err)
+			defer c.Close()
+			data := []byte(fmt.Sprintf("%04d", i))
+			_, err = c.Write(data)
+			require.NoError(s.tester, err)
+			buf := make([]byte, len(data))
+			_, err = io.ReadFull(c, buf)
+			require.NoError(s.tester, err)
+			assert.Equal(s.tester, data, buf)
+			// Keep the connection open until all connections are opened.
+			wg.Done()
+			done.Wait()
+		}(i)
+	}
+	wg.Wait()
+	done.Done()
+	assert.EqualValues(s.tester, n, atomic.LoadInt32(&s.opened))
+	if s.spread {
+		// The connections accepted in a batch are spread across event-loops.
+		minN, maxN := int32(n), int32(0)
+		for i := range s.loops {
+			c := atomic.LoadInt32(&s.loops[i])
+			if c < minN {
+				minN = c
+			}
+			if c > maxN {
+				maxN = c
+			}
+		}
+		assert.LessOrEqual(s.tester, maxN-minN, int32(2), "connections per event-loop: %v", s.loops)
+	}
+}
+
+func testAcceptBatch(t *testing.T, network, addr string, reusePort bool, lb LoadBalancing, balancer LoadBalancer) {
+	svr := &testAcceptBatchServer{
+		scenarioServer: scenarioServer{tester: t, network: network, addr: addr},
+		spread:         lb == LeastConnections || balancer != nil,
+	}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithAcceptBatch(16),
+		WithReusePort(reusePort),
+		WithLoadBalancing(lb),
+		WithLoadBalancer(balancer),
+		WithNumEventLoop(4))
+	assert.NoError(t, err)
+}
+
 func TestStopServer(t *testing.T) {
 	testStop(t, "tcp", ":9997")
 }
@@ -1437,3 +2343,77 @@ func batchSendAndRecv(t *testing.T, c net.Conn, rd *bufio.Reader, packetSize, ba
 		require.Equalf(t, req, rsp, "request and response mismatch, packet size: %d, batch: %d", packetSize, batch)
 	}
 }
+
+func TestNextRetained(t *testing.T) {
+	svr := &testNextRetainedServer{scenarioServer: scenarioServer{tester: t, network: "tcp", addr: ":9962"}, retained: make(chan retainedData, 1024)}
+	svr.scenario = svr.run
+	err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true), WithReadBufferCap(1024))
+	assert.NoError(t, err)
+
+	rb := retainCopy([]byte("gnet"))
+	rb.Retain()
+	rb.Release()
+	rb.Release()
+	assert.Panics(t, rb.Release, "releasing a buffer more times than it's retained should panic")
+}
+
+type retainedData struct {
+	c  Conn
+	rb *RetainedBuffer
+}
+
+type testNextRetainedServer struct {
+	scenarioServer
+	retained chan retainedData
+}
+
+func (s *testNextRetainedServer) OnBoot(_ Engine) (action Action) {
+	go func() {
+		// Echo the data from another goroutine long after OnTraffic returns.
+		for d := range s.retained {
+			time.Sleep(100 * time.Microsecond)
+			rb := d.rb
+			err := d.c.AsyncWrite(rb.Bytes(), func(_ Conn, _ error) error {
+				rb.Release()
+				return nil
+			})
+			assert.NoError(s.tester, err)
+		}
+	}()
+	return
+}
+
+func (s *testNextRetainedServer) OnShutdown(_ Engine) {
+	close(s.retained)
+}
+
+func (s *testNextRetainedServer) OnTraffic(c Conn) (action Action) {
+	for c.InboundBuffered() > 0 {
+		// Split the data into two parts to get the buffer shared by multiple RetainedBuffers.
+		rb, err := c.NextRetained((c.InboundBuffered() + 1) / 2)
+		require.NoError(s.tester, err)
+		s.retained <- retainedData{c, rb}
+	}
+	return
+}
+
+func (s *testNextRetainedServer) run() {
+	c, err := net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close() //nolint:errcheck
+	data := make([]byte, 128*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	go func() {
+		for i := 0; i < len(data); i += 4096 {
+			_, err := c.Write(data[i : i+4096])
+			assert.NoError(s.tester, err)
+		}
+	}()
+	buf := make([]byte, len(data))
+	require.NoError(s.tester, c.SetReadDeadline(time.Now().Add(10*time.Second)))
+	_, err = io.ReadFull(c, buf)
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, data, buf, "the retained data should not be overwritten by the subsequent reads")
+}
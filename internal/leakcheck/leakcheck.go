@@ -0,0 +1,24 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package leakcheck records the allocation stacks of buffers when gnet is built with the
+// gnet_leakcheck tag, so that the buffers which are never freed can be reported.
+package leakcheck
+
+// Record describes a buffer that has been allocated but not freed yet.
+type Record struct {
+	Kind  string // kind of the tracker
+	Size  int    // size of the buffer
+	Stack string // stack trace of the allocation
+}
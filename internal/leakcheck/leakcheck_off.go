@@ -0,0 +1,41 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !gnet_leakcheck
+// +build !gnet_leakcheck
+
+package leakcheck
+
+// Enabled reports whether the allocations are tracked.
+const Enabled = false
+
+// Tracker is a no-op without the gnet_leakcheck tag.
+type Tracker struct {
+	Kind string // kind of the buffers, e.g. the name of pool
+}
+
+// Register is a no-op without the gnet_leakcheck tag.
+func Register(t *Tracker) *Tracker { return t }
+
+// Outstanding always returns nil without the gnet_leakcheck tag.
+func Outstanding() []Record { return nil }
+
+// Track is a no-op without the gnet_leakcheck tag.
+func (*Tracker) Track(uintptr, int, int) {}
+
+// Untrack always reports true without the gnet_leakcheck tag.
+func (*Tracker) Untrack(uintptr) bool { return true }
+
+// Records always returns nil without the gnet_leakcheck tag.
+func (*Tracker) Records() []Record { return nil }
@@ -0,0 +1,120 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gnet_leakcheck
+// +build gnet_leakcheck
+
+package leakcheck
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Enabled reports whether the allocations are tracked.
+const Enabled = true
+
+// Tracker keeps the allocation stacks of the outstanding buffers, the zero value is ready to use.
+type Tracker struct {
+	Kind string // kind of the buffers, e.g. the name of pool
+
+	mu      sync.Mutex
+	records map[uintptr]Record
+}
+
+var registry struct {
+	sync.Mutex
+	trackers []*Tracker
+}
+
+// Register adds t to the trackers whose records are reported by Outstanding.
+func Register(t *Tracker) *Tracker {
+	registry.Lock()
+	registry.trackers = append(registry.trackers, t)
+	registry.Unlock()
+	return t
+}
+
+// Outstanding returns the records of all registered trackers.
+func Outstanding() []Record {
+	registry.Lock()
+	trackers := registry.trackers
+	registry.Unlock()
+	var records []Record
+	for _, t := range trackers {
+		records = append(records, t.Records()...)
+	}
+	return records
+}
+
+// Track records the allocation of the buffer identified by key, skip is the number of
+// stack frames to skip above the caller of Track.
+func (t *Tracker) Track(key uintptr, size, skip int) {
+	stack := callers(skip + 2)
+	t.mu.Lock()
+	if t.records == nil {
+		t.records = make(map[uintptr]Record)
+	}
+	t.records[key] = Record{t.Kind, size, stack}
+	t.mu.Unlock()
+}
+
+// Untrack removes the record of the buffer identified by key, it returns false
+// if the buffer is not being tracked, e.g. it has been freed already.
+func (t *Tracker) Untrack(key uintptr) bool {
+	t.mu.Lock()
+	_, ok := t.records[key]
+	delete(t.records, key)
+	t.mu.Unlock()
+	return ok
+}
+
+// Records returns the records of all outstanding buffers.
+func (t *Tracker) Records() []Record {
+	t.mu.Lock()
+	records := make([]Record, 0, len(t.records))
+	for _, r := range t.records {
+		records = append(records, r)
+	}
+	t.mu.Unlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].Stack < records[j].Stack })
+	return records
+}
+
+func callers(skip int) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+1, pcs)
+	if n == 0 {
+		return ""
+	}
+	frames := runtime.CallersFrames(pcs[:n])
+	var sb strings.Builder
+	for {
+		frame, more := frames.Next()
+		sb.WriteString("  ")
+		sb.WriteString(frame.Function)
+		sb.WriteString("()\n      ")
+		sb.WriteString(frame.File)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Itoa(frame.Line))
+		sb.WriteByte('\n')
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
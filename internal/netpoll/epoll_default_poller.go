@@ -40,6 +40,7 @@ type Poller struct {
 	asyncTaskQueue              queue.AsyncTaskQueue // queue with low priority
 	urgentAsyncTaskQueue        queue.AsyncTaskQueue // queue with high priority
 	highPriorityEventsThreshold int32                // threshold of high-priority events
+	iteration                   uint64               // number of polling rounds that got events
 }
 
 // OpenPoller instantiates a poller.
@@ -107,6 +108,17 @@ func (p *Poller) Trigger(priority queue.EventPriority, fn queue.TaskFunc, arg in
 	return os.NewSyscallError("write", err)
 }
 
+// PendingTasks returns the number of asynchronous tasks waiting to be run by the poller.
+func (p *Poller) PendingTasks() int {
+	return int(p.urgentAsyncTaskQueue.Length() + p.asyncTaskQueue.Length())
+}
+
+// Iteration returns the number of polling rounds that have got events so far,
+// it's only meant to be called within the callback of Polling.
+func (p *Poller) Iteration() uint64 {
+	return p.iteration
+}
+
 // Polling blocks the current goroutine, waiting for network-events.
 func (p *Poller) Polling(callback PollEventHandler) error {
 	el := newEventList(InitPollEventsCap)
@@ -124,6 +136,7 @@ func (p *Poller) Polling(callback PollEventHandler) error {
 			return err
 		}
 		msec = 0
+		p.iteration++
 
 		for i := 0; i < n; i++ {
 			ev := &el.events[i]
@@ -186,9 +199,13 @@ func (p *Poller) Polling(callback PollEventHandler) error {
 }
 
 const (
-	readEvents      = unix.EPOLLPRI | unix.EPOLLIN
+	readEvents      = unix.EPOLLPRI | unix.EPOLLIN | unix.EPOLLRDHUP
 	writeEvents     = unix.EPOLLOUT
 	readWriteEvents = readEvents | writeEvents
+	// edgeEvents watches both readable and writable events and the shutdown of peer in edge-triggered mode.
+	edgeEvents = readWriteEvents | unix.EPOLLET
+	// edgeWriteEvents watches the writable events and the shutdown of peer in edge-triggered mode.
+	edgeWriteEvents = writeEvents | unix.EPOLLRDHUP | unix.EPOLLET
 )
 
 // AddReadWrite registers the given file-descriptor with readable and writable events to the poller.
@@ -197,6 +214,27 @@ func (p *Poller) AddReadWrite(pa *PollAttachment) error {
 		unix.EpollCtl(p.fd, unix.EPOLL_CTL_ADD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: readWriteEvents}))
 }
 
+// AddEdgeTriggered registers the given file-descriptor with readable, writable and peer-shutdown events
+// to the poller in edge-triggered mode, the caller must read and write it until EAGAIN on each event.
+func (p *Poller) AddEdgeTriggered(pa *PollAttachment) error {
+	return os.NewSyscallError("epoll_ctl add",
+		unix.EpollCtl(p.fd, unix.EPOLL_CTL_ADD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: edgeEvents}))
+}
+
+// RearmEdgeTriggered re-registers the given file-descriptor in edge-triggered mode, which makes the poller
+// report the events that are still pending, so that the caller can stop reading it before EAGAIN.
+func (p *Poller) RearmEdgeTriggered(pa *PollAttachment) error {
+	return os.NewSyscallError("epoll_ctl mod",
+		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: edgeEvents}))
+}
+
+// ModEdgeTriggeredWrite re-registers the given file-descriptor in edge-triggered mode without the readable
+// events, the poller keeps reporting its writable events and the shutdown of peer.
+func (p *Poller) ModEdgeTriggeredWrite(pa *PollAttachment) error {
+	return os.NewSyscallError("epoll_ctl mod",
+		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: edgeWriteEvents}))
+}
+
 // AddRead registers the given file-descriptor with readable event to the poller.
 func (p *Poller) AddRead(pa *PollAttachment) error {
 	return os.NewSyscallError("epoll_ctl add",
@@ -215,6 +253,19 @@ func (p *Poller) ModRead(pa *PollAttachment) error {
 		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: readEvents}))
 }
 
+// ModWrite renews the given file-descriptor with writable event in the poller.
+func (p *Poller) ModWrite(pa *PollAttachment) error {
+	return os.NewSyscallError("epoll_ctl mod",
+		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD), Events: writeEvents}))
+}
+
+// ModNone renews the given file-descriptor without readable and writable events in the poller,
+// only the exceptional events are reported for it.
+func (p *Poller) ModNone(pa *PollAttachment) error {
+	return os.NewSyscallError("epoll_ctl mod",
+		unix.EpollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &unix.EpollEvent{Fd: int32(pa.FD)}))
+}
+
 // ModReadWrite renews the given file-descriptor with readable and writable events in the poller.
 func (p *Poller) ModReadWrite(pa *PollAttachment) error {
 	return os.NewSyscallError("epoll_ctl mod",
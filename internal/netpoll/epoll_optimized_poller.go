@@ -39,6 +39,7 @@ type Poller struct {
 	asyncTaskQueue              queue.AsyncTaskQueue // queue with low priority
 	urgentAsyncTaskQueue        queue.AsyncTaskQueue // queue with high priority
 	highPriorityEventsThreshold int32                // threshold of high-priority events
+	iteration                   uint64               // number of polling rounds that got events
 }
 
 // OpenPoller instantiates a poller.
@@ -108,6 +109,17 @@ func (p *Poller) Trigger(priority queue.EventPriority, fn queue.TaskFunc, arg in
 	return os.NewSyscallError("write", err)
 }
 
+// PendingTasks returns the number of asynchronous tasks waiting to be run by the poller.
+func (p *Poller) PendingTasks() int {
+	return int(p.urgentAsyncTaskQueue.Length() + p.asyncTaskQueue.Length())
+}
+
+// Iteration returns the number of polling rounds that have got events so far,
+// it's only meant to be called within the callback of Polling.
+func (p *Poller) Iteration() uint64 {
+	return p.iteration
+}
+
 // Polling blocks the current goroutine, waiting for network-events.
 func (p *Poller) Polling() error {
 	el := newEventList(InitPollEventsCap)
@@ -125,6 +137,7 @@ func (p *Poller) Polling() error {
 			return err
 		}
 		msec = 0
+		p.iteration++
 
 		for i := 0; i < n; i++ {
 			ev := &el.events[i]
@@ -188,9 +201,13 @@ func (p *Poller) Polling() error {
 }
 
 const (
-	readEvents      = unix.EPOLLPRI | unix.EPOLLIN
+	readEvents      = unix.EPOLLPRI | unix.EPOLLIN | unix.EPOLLRDHUP
 	writeEvents     = unix.EPOLLOUT
 	readWriteEvents = readEvents | writeEvents
+	// edgeEvents watches both readable and writable events and the shutdown of peer in edge-triggered mode.
+	edgeEvents = readWriteEvents | unix.EPOLLET
+	// edgeWriteEvents watches the writable events and the shutdown of peer in edge-triggered mode.
+	edgeWriteEvents = writeEvents | unix.EPOLLRDHUP | unix.EPOLLET
 )
 
 // AddReadWrite registers the given file-descriptor with readable and writable events to the poller.
@@ -201,6 +218,33 @@ func (p *Poller) AddReadWrite(pa *PollAttachment) error {
 	return os.NewSyscallError("epoll_ctl add", epollCtl(p.fd, unix.EPOLL_CTL_ADD, pa.FD, &ev))
 }
 
+// AddEdgeTriggered registers the given file-descriptor with readable, writable and peer-shutdown events
+// to the poller in edge-triggered mode, the caller must read and write it until EAGAIN on each event.
+func (p *Poller) AddEdgeTriggered(pa *PollAttachment) error {
+	var ev epollevent
+	ev.events = edgeEvents
+	*(**PollAttachment)(unsafe.Pointer(&ev.data)) = pa
+	return os.NewSyscallError("epoll_ctl add", epollCtl(p.fd, unix.EPOLL_CTL_ADD, pa.FD, &ev))
+}
+
+// RearmEdgeTriggered re-registers the given file-descriptor in edge-triggered mode, which makes the poller
+// report the events that are still pending, so that the caller can stop reading it before EAGAIN.
+func (p *Poller) RearmEdgeTriggered(pa *PollAttachment) error {
+	var ev epollevent
+	ev.events = edgeEvents
+	*(**PollAttachment)(unsafe.Pointer(&ev.data)) = pa
+	return os.NewSyscallError("epoll_ctl mod", epollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &ev))
+}
+
+// ModEdgeTriggeredWrite re-registers the given file-descriptor in edge-triggered mode without the readable
+// events, the poller keeps reporting its writable events and the shutdown of peer.
+func (p *Poller) ModEdgeTriggeredWrite(pa *PollAttachment) error {
+	var ev epollevent
+	ev.events = edgeWriteEvents
+	*(**PollAttachment)(unsafe.Pointer(&ev.data)) = pa
+	return os.NewSyscallError("epoll_ctl mod", epollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &ev))
+}
+
 // AddRead registers the given file-descriptor with readable event to the poller.
 func (p *Poller) AddRead(pa *PollAttachment) error {
 	var ev epollevent
@@ -225,6 +269,22 @@ func (p *Poller) ModRead(pa *PollAttachment) error {
 	return os.NewSyscallError("epoll_ctl mod", epollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &ev))
 }
 
+// ModWrite renews the given file-descriptor with writable event in the poller.
+func (p *Poller) ModWrite(pa *PollAttachment) error {
+	var ev epollevent
+	ev.events = writeEvents
+	*(**PollAttachment)(unsafe.Pointer(&ev.data)) = pa
+	return os.NewSyscallError("epoll_ctl mod", epollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &ev))
+}
+
+// ModNone renews the given file-descriptor without readable and writable events in the poller,
+// only the exceptional events are reported for it.
+func (p *Poller) ModNone(pa *PollAttachment) error {
+	var ev epollevent
+	*(**PollAttachment)(unsafe.Pointer(&ev.data)) = pa
+	return os.NewSyscallError("epoll_ctl mod", epollCtl(p.fd, unix.EPOLL_CTL_MOD, pa.FD, &ev))
+}
+
 // ModReadWrite renews the given file-descriptor with readable and writable events in the poller.
 func (p *Poller) ModReadWrite(pa *PollAttachment) error {
 	var ev epollevent
@@ -38,6 +38,7 @@ type Poller struct {
 	asyncTaskQueue              queue.AsyncTaskQueue // queue with low priority
 	urgentAsyncTaskQueue        queue.AsyncTaskQueue // queue with high priority
 	highPriorityEventsThreshold int32                // threshold of high-priority events
+	iteration                   uint64               // number of polling rounds that got events
 }
 
 // OpenPoller instantiates a poller.
@@ -99,6 +100,17 @@ func (p *Poller) Trigger(priority queue.EventPriority, fn queue.TaskFunc, arg in
 	return os.NewSyscallError("kevent trigger", err)
 }
 
+// PendingTasks returns the number of asynchronous tasks waiting to be run by the poller.
+func (p *Poller) PendingTasks() int {
+	return int(p.urgentAsyncTaskQueue.Length() + p.asyncTaskQueue.Length())
+}
+
+// Iteration returns the number of polling rounds that have got events so far,
+// it's only meant to be called within the callback of Polling.
+func (p *Poller) Iteration() uint64 {
+	return p.iteration
+}
+
 // Polling blocks the current goroutine, waiting for network-events.
 func (p *Poller) Polling() error {
 	el := newEventList(InitPollEventsCap)
@@ -119,6 +131,7 @@ func (p *Poller) Polling() error {
 			return err
 		}
 		tsp = &ts
+		p.iteration++
 
 		for i := 0; i < n; i++ {
 			ev := &el.events[i]
@@ -226,6 +239,17 @@ func (p *Poller) ModRead(pa *PollAttachment) error {
 	return os.NewSyscallError("kevent delete", err)
 }
 
+// ModWrite renews the given file-descriptor with writable event in the poller.
+func (p *Poller) ModWrite(pa *PollAttachment) error {
+	var evs [1]unix.Kevent_t
+	evs[0].Ident = keventIdent(pa.FD)
+	evs[0].Flags = unix.EV_DELETE
+	evs[0].Filter = unix.EVFILT_READ
+	evs[0].Udata = (*byte)(unsafe.Pointer(pa))
+	_, err := unix.Kevent(p.fd, evs[:], nil, nil)
+	return os.NewSyscallError("kevent delete", err)
+}
+
 // ModReadWrite renews the given file-descriptor with readable and writable events in the poller.
 func (p *Poller) ModReadWrite(pa *PollAttachment) error {
 	var evs [1]unix.Kevent_t
@@ -24,6 +24,9 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// abstractUnixSocketSupported indicates whether the abstract namespace of unix domain socket is available.
+const abstractUnixSocketSupported = false
+
 func maxListenerBacklog() int {
 	var (
 		n   uint32
@@ -24,6 +24,9 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// abstractUnixSocketSupported indicates whether the abstract namespace of unix domain socket is available.
+const abstractUnixSocketSupported = true
+
 func maxListenerBacklog() int {
 	fd, err := os.Open("/proc/sys/net/core/somaxconn")
 	if err != nil {
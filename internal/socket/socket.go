@@ -43,8 +43,8 @@ func UDPSocket(proto, addr string, connect bool, sockOpts ...Option) (int, net.A
 }
 
 // UnixSocket calls the internal udsSocket.
-func UnixSocket(proto, addr string, passive bool, sockOpts ...Option) (int, net.Addr, error) {
-	return udsSocket(proto, addr, passive, sockOpts...)
+func UnixSocket(proto, addr string, passive bool, bound func(string) error, sockOpts ...Option) (int, net.Addr, error) {
+	return udsSocket(proto, addr, passive, bound, sockOpts...)
 }
 
 // Accept accepts the next incoming socket along with setting
@@ -0,0 +1,55 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build freebsd || dragonfly || netbsd || openbsd || darwin
+// +build freebsd dragonfly netbsd openbsd darwin
+
+package socket
+
+import "github.com/panjf2000/gnet/v2/pkg/errors"
+
+// SetReuseportCPUSteering is not supported on BSD-like OSs, SO_ATTACH_REUSEPORT_CBPF is Linux-specific.
+func SetReuseportCPUSteering(_, _ int) error {
+	return errors.ErrUnsupportedOp
+}
+
+// SetReuseportHashSteering is not supported on BSD-like OSs, SO_ATTACH_REUSEPORT_CBPF is Linux-specific.
+func SetReuseportHashSteering(_, _ int) error {
+	return errors.ErrUnsupportedOp
+}
+
+// SetFastOpen is not supported on BSD-like OSs.
+func SetFastOpen(_, _ int) error {
+	return errors.ErrUnsupportedOp
+}
+
+// SetUserTimeout is not supported on BSD-like OSs, TCP_USER_TIMEOUT is Linux-specific.
+func SetUserTimeout(_, _ int) error {
+	return errors.ErrUnsupportedOp
+}
+
+// SetQuickAck is not supported on BSD-like OSs, TCP_QUICKACK is Linux-specific.
+func SetQuickAck(_, _ int) error {
+	return errors.ErrUnsupportedOp
+}
+
+// SetDeferAccept is not supported on BSD-like OSs, TCP_DEFER_ACCEPT is Linux-specific.
+func SetDeferAccept(_, _ int) error {
+	return errors.ErrUnsupportedOp
+}
+
+// SetBusyPoll is not supported on BSD-like OSs, SO_BUSY_POLL is Linux-specific.
+func SetBusyPoll(_, _ int) error {
+	return errors.ErrUnsupportedOp
+}
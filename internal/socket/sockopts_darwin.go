@@ -24,22 +24,26 @@ import (
 // SetKeepAlivePeriod sets whether the operating system should send
 // keep-alive messages on the connection and sets period between keep-alive's.
 func SetKeepAlivePeriod(fd, secs int) error {
-	if secs <= 0 {
+	return SetKeepAlive(fd, secs, 0, 0)
+}
+
+// SetKeepAlive enables TCP keep-alive on the socket with the idle time before the first probe,
+// the interval between probes and the number of unacknowledged probes before dropping the connection.
+// The interval defaults to one fifth of idle time and the count defaults to 5 if they are not positive.
+func SetKeepAlive(fd, idle, interval, count int) error {
+	if idle <= 0 {
 		return errors.New("invalid time duration")
 	}
+	interval, count = keepAliveDefaults(idle, interval, count)
 
 	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1); err != nil {
 		return os.NewSyscallError("setsockopt", err)
 	}
 
-	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPALIVE, secs); err != nil {
+	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPALIVE, idle); err != nil {
 		return os.NewSyscallError("setsockopt", err)
 	}
 
-	interval := secs / 5
-	if interval == 0 {
-		interval = 1
-	}
 	if err := unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, interval); err != nil {
 		// In earlier versions, macOS only supported setting TCP_KEEPALIVE (the equivalent of TCP_KEEPIDLE on other platforms),
 		// but since macOS 10.8 it has supported TCP_KEEPINTVL and TCP_KEEPCNT.
@@ -50,5 +54,5 @@ func SetKeepAlivePeriod(fd, secs int) error {
 		return os.NewSyscallError("setsockopt", err)
 	}
 
-	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, 5))
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, count))
 }
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socket
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Ancillary data offsets of classic BPF, see linux/filter.h.
+const (
+	skfAdOff    = 0xfffff000 // SKF_AD_OFF(-0x1000) in two's complement
+	skfAdRxhash = 32         // SKF_AD_RXHASH
+	skfAdCPU    = 36         // SKF_AD_CPU
+)
+
+// reuseportFilter returns a classic BPF program that selects the socket in a SO_REUSEPORT group
+// by taking the remainder of the given ancillary data divided by the size of group.
+func reuseportFilter(ancillary uint32, groupSize int) []unix.SockFilter {
+	return []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: skfAdOff + ancillary},
+		{Code: unix.BPF_ALU | unix.BPF_MOD | unix.BPF_K, K: uint32(groupSize)},
+		{Code: unix.BPF_RET | unix.BPF_A},
+	}
+}
+
+func attachReuseportFilter(fd int, filter []unix.SockFilter) error {
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return os.NewSyscallError("setsockopt", unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_REUSEPORT_CBPF, &prog))
+}
+
+// SetReuseportCPUSteering attaches a classic BPF program to the SO_REUSEPORT group of the socket,
+// which dispatches packets to the socket whose index in group equals the number of the CPU
+// handling the packet modulo the size of group.
+func SetReuseportCPUSteering(fd, groupSize int) error {
+	return attachReuseportFilter(fd, reuseportFilter(skfAdCPU, groupSize))
+}
+
+// SetReuseportHashSteering attaches a classic BPF program to the SO_REUSEPORT group of the socket,
+// which dispatches packets to the socket whose index in group equals the receive hash of the packet
+// modulo the size of group.
+func SetReuseportHashSteering(fd, groupSize int) error {
+	return attachReuseportFilter(fd, reuseportFilter(skfAdRxhash, groupSize))
+}
+
+// SetFastOpen enables TCP Fast Open (TCP_FASTOPEN) on the listener with the given length of the
+// queue of pending TFO requests.
+func SetFastOpen(fd, qlen int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_FASTOPEN, qlen))
+}
+
+// SetUserTimeout sets the maximum time in milliseconds that transmitted data may remain
+// unacknowledged before TCP forcibly closes the connection (TCP_USER_TIMEOUT).
+func SetUserTimeout(fd, msecs int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, msecs))
+}
+
+// SetQuickAck enables or disables the quick ACK mode (TCP_QUICKACK) on the socket,
+// note that the mode isn't permanent, the kernel may leave it later.
+func SetQuickAck(fd, quickAck int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_QUICKACK, quickAck))
+}
+
+// SetDeferAccept lets the listener wake up only when data arrives on the new connection,
+// within the given seconds (TCP_DEFER_ACCEPT).
+func SetDeferAccept(fd, secs int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_DEFER_ACCEPT, secs))
+}
+
+// SetBusyPoll sets the approximate time in microseconds to busy poll on a blocking receive
+// when there is no data (SO_BUSY_POLL).
+func SetBusyPoll(fd, usecs int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BUSY_POLL, usecs))
+}
@@ -22,3 +22,10 @@ func SetKeepAlivePeriod(_, _ int) error {
 	// OpenBSD has no user-settable per-socket TCP keepalive options.
 	return unix.ENOPROTOOPT
 }
+
+// SetKeepAlive enables TCP keep-alive on the socket with the idle time before the first probe,
+// the interval between probes and the number of unacknowledged probes before dropping the connection.
+func SetKeepAlive(_, _, _, _ int) error {
+	// OpenBSD has no user-settable per-socket TCP keepalive options.
+	return unix.ENOPROTOOPT
+}
@@ -36,6 +36,25 @@ func SetNoDelay(fd, noDelay int) error {
 	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_NODELAY, noDelay))
 }
 
+// SetSockOptInt sets an integer socket option at the given level on the socket.
+func SetSockOptInt(fd, level, name, value int) error {
+	return os.NewSyscallError("setsockopt", unix.SetsockoptInt(fd, level, name, value))
+}
+
+// keepAliveDefaults fills in the interval and count of TCP keep-alive probes if they are not set.
+func keepAliveDefaults(idle, interval, count int) (int, int) {
+	if interval <= 0 {
+		interval = idle / 5
+		if interval == 0 {
+			interval = 1
+		}
+	}
+	if count <= 0 {
+		count = 5
+	}
+	return interval, count
+}
+
 // SetRecvBuffer sets the size of the operating system's
 // receive buffer associated with the connection.
 func SetRecvBuffer(fd, size int) error {
@@ -34,7 +34,11 @@ func GetUnixSockAddr(proto, addr string) (sa unix.Sockaddr, family int, unixAddr
 	}
 
 	switch unixAddr.Network() {
-	case "unix":
+	case "unix", "unixgram", "unixpacket":
+		if IsAbstractUnixAddr(unixAddr.Name) && !abstractUnixSocketSupported {
+			err = errors.ErrUnsupportedOp
+			return
+		}
 		sa, family = &unix.SockaddrUnix{Name: unixAddr.Name}, unix.AF_UNIX
 	default:
 		err = errors.ErrUnsupportedUDSProtocol
@@ -43,9 +47,26 @@ func GetUnixSockAddr(proto, addr string) (sa unix.Sockaddr, family int, unixAddr
 	return
 }
 
+// IsAbstractUnixAddr reports whether the address of unix domain socket is in the abstract namespace,
+// which is denoted by a leading '@' and has no presence in the filesystem.
+func IsAbstractUnixAddr(addr string) bool {
+	return len(addr) > 0 && addr[0] == '@'
+}
+
+func unixSockType(proto string) int {
+	switch proto {
+	case "unixgram":
+		return unix.SOCK_DGRAM
+	case "unixpacket":
+		return unix.SOCK_SEQPACKET
+	default:
+		return unix.SOCK_STREAM
+	}
+}
+
 // udsSocket creates an endpoint for communication and returns a file descriptor that refers to that endpoint.
-// Argument `reusePort` indicates whether the SO_REUSEPORT flag will be assigned.
-func udsSocket(proto, addr string, passive bool, sockOpts ...Option) (fd int, netAddr net.Addr, err error) {
+// Argument `bound` is invoked with the socket file right after it's bound and before it starts listening.
+func udsSocket(proto, addr string, passive bool, bound func(string) error, sockOpts ...Option) (fd int, netAddr net.Addr, err error) {
 	var (
 		family int
 		sa     unix.Sockaddr
@@ -55,7 +76,8 @@ func udsSocket(proto, addr string, passive bool, sockOpts ...Option) (fd int, ne
 		return
 	}
 
-	if fd, err = sysSocket(family, unix.SOCK_STREAM, 0); err != nil {
+	sotype := unixSockType(proto)
+	if fd, err = sysSocket(family, sotype, 0); err != nil {
 		err = os.NewSyscallError("socket", err)
 		return
 	}
@@ -80,6 +102,14 @@ func udsSocket(proto, addr string, passive bool, sockOpts ...Option) (fd int, ne
 		if err = os.NewSyscallError("bind", unix.Bind(fd, sa)); err != nil {
 			return
 		}
+		if bound != nil && !IsAbstractUnixAddr(addr) {
+			if err = bound(addr); err != nil {
+				return
+			}
+		}
+		if sotype == unix.SOCK_DGRAM {
+			return
+		}
 
 		// Set backlog size to the maximum.
 		err = os.NewSyscallError("listen", unix.Listen(fd, listenerBacklogMaxSize))
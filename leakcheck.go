@@ -0,0 +1,106 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/panjf2000/gnet/v2/internal/leakcheck"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// BufferLeak describes a buffer taken from a pool that has never been returned.
+type BufferLeak struct {
+	Kind  string // where the buffer comes from: "byteslice", "ringbuffer" or "slab"
+	Size  int    // capacity of the buffer
+	Stack string // stack trace of the allocation
+}
+
+// BufferLeaks returns the buffers taken from the built-in pools of byte slices and ring-buffers
+// that have not been returned yet, including those held by elastic.Buffer and linkedlist.Buffer,
+// as well as the byte slices allocated by any allocator.Slab and never freed.
+// The allocations are only tracked when gnet is built with the gnet_leakcheck tag, otherwise it
+// always returns nil.
+//
+// Note that the buffers in use by the running engines and clients are reported as well,
+// thus it's meant to be called after all of them have stopped, e.g. at the end of tests.
+func BufferLeaks() []BufferLeak {
+	records := leakcheck.Outstanding()
+	if len(records) == 0 {
+		return nil
+	}
+	leaks := make([]BufferLeak, len(records))
+	for i, r := range records {
+		leaks[i] = BufferLeak{r.Kind, r.Size, r.Stack}
+	}
+	return leaks
+}
+
+// CheckBufferLeaks returns an error wrapping errors.ErrBufferLeaked if BufferLeaks reports any
+// leaked buffers, the error message lists them along with their allocation stacks. It's meant to
+// be used in TestMain with the gnet_leakcheck tag:
+//
+//	func TestMain(m *testing.M) {
+//		code := m.Run()
+//		if err := gnet.CheckBufferLeaks(); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			code = 1
+//		}
+//		os.Exit(code)
+//	}
+func CheckBufferLeaks() error {
+	leaks := BufferLeaks()
+	if len(leaks) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w\n%s", errorx.ErrBufferLeaked, formatBufferLeaks(leaks))
+}
+
+// formatBufferLeaks reports the leaked buffers in the manner of the race detector,
+// the buffers allocated at the same place are reported together.
+func formatBufferLeaks(leaks []BufferLeak) string {
+	type site struct {
+		kind, stack string
+	}
+	var (
+		sites  []site
+		counts = make(map[site]int)
+		bytes  = make(map[site]int)
+	)
+	for _, l := range leaks {
+		s := site{l.Kind, l.Stack}
+		if counts[s] == 0 {
+			sites = append(sites, s)
+		}
+		counts[s]++
+		bytes[s] += l.Size
+	}
+
+	var sb strings.Builder
+	for _, s := range sites {
+		sb.WriteString("==================\n")
+		sb.WriteString("WARNING: BUFFER LEAK\n")
+		fmt.Fprintf(&sb, "%d buffer(s) ", counts[s])
+		if bytes[s] > 0 {
+			fmt.Fprintf(&sb, "of %d bytes in total ", bytes[s])
+		}
+		fmt.Fprintf(&sb, "taken from the %s pool and never returned, allocated at:\n", s.kind)
+		sb.WriteString(s.stack)
+		sb.WriteString("==================\n")
+	}
+	fmt.Fprintf(&sb, "Found %d leaked buffer(s)", len(leaks))
+	return sb.String()
+}
@@ -0,0 +1,65 @@
+package gnet
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2/internal/leakcheck"
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
+	rbPool "github.com/panjf2000/gnet/v2/pkg/pool/ringbuffer"
+)
+
+// TestMain fails the tests built with the gnet_leakcheck tag if any pooled buffer is leaked.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if err := CheckBufferLeaks(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+func TestBufferLeaks(t *testing.T) {
+	require.NoError(t, CheckBufferLeaks())
+
+	slab := allocator.NewSlab(0, 0, 0)
+	buf := bsPool.Get(100)
+	rb := rbPool.Get()
+	_, _ = rb.Write(buf)
+	sb := slab.Alloc(200)
+	if !leakcheck.Enabled {
+		assert.Nil(t, BufferLeaks())
+		assert.NoError(t, CheckBufferLeaks())
+		return
+	}
+
+	leaks := BufferLeaks()
+	require.Len(t, leaks, 3)
+	for _, l := range leaks {
+		assert.Contains(t, l.Stack, "gnet/v2.TestBufferLeaks()")
+		switch l.Kind {
+		case "byteslice":
+			assert.Equal(t, 128, l.Size)
+		case "ringbuffer":
+		case "slab":
+			assert.Equal(t, 256, l.Size)
+		default:
+			assert.Fail(t, "unexpected kind of leak", l.Kind)
+		}
+	}
+	err := CheckBufferLeaks()
+	assert.ErrorIs(t, err, errorx.ErrBufferLeaked)
+	assert.Contains(t, err.Error(), "WARNING: BUFFER LEAK\n1 buffer(s) of 128 bytes in total taken from the byteslice pool and never returned")
+	assert.Contains(t, err.Error(), "Found 3 leaked buffer(s)")
+
+	bsPool.Put(buf)
+	rbPool.Put(rb)
+	slab.Free(sb)
+	assert.Nil(t, BufferLeaks())
+}
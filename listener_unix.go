@@ -37,6 +37,7 @@ type listener struct {
 	addr             net.Addr
 	address, network string
 	sockOpts         []socket.Option
+	sockFile         *UnixSocketFile         // permission and ownership of the unix socket file
 	pollAttachment   *netpoll.PollAttachment // listener attachment for poller
 }
 
@@ -49,6 +50,17 @@ func (ln *listener) dup() (int, string, error) {
 	return netpoll.Dup(ln.fd)
 }
 
+// isDatagram reports whether the listener is connectionless, which reads packets directly
+// instead of accepting connections.
+func (ln *listener) isDatagram() bool {
+	return ln.network == "udp" || ln.network == "unixgram"
+}
+
+// isUnixFile reports whether the listener is a unix domain socket in the filesystem.
+func (ln *listener) isUnixFile() bool {
+	return strings.HasPrefix(ln.network, "unix") && !socket.IsAbstractUnixAddr(ln.address)
+}
+
 func (ln *listener) normalize() (err error) {
 	switch ln.network {
 	case "tcp", "tcp4", "tcp6":
@@ -57,22 +69,42 @@ func (ln *listener) normalize() (err error) {
 	case "udp", "udp4", "udp6":
 		ln.fd, ln.addr, err = socket.UDPSocket(ln.network, ln.address, false, ln.sockOpts...)
 		ln.network = "udp"
-	case "unix":
-		_ = os.RemoveAll(ln.address)
-		ln.fd, ln.addr, err = socket.UnixSocket(ln.network, ln.address, true, ln.sockOpts...)
+	case "unix", "unixgram", "unixpacket":
+		var bound func(string) error
+		if ln.sockFile != nil {
+			bound = ln.sockFile.apply
+		}
+		if ln.isUnixFile() {
+			_ = os.RemoveAll(ln.address)
+		}
+		ln.fd, ln.addr, err = socket.UnixSocket(ln.network, ln.address, true, bound, ln.sockOpts...)
 	default:
 		err = errors.ErrUnsupportedProtocol
 	}
 	return
 }
 
+// steer attaches the steering program to the SO_REUSEPORT group of listener,
+// n is the number of listeners in the group. It returns errors.ErrUnsupportedOp
+// for any steering other than SteerByKernel on BSD-like OSs.
+func (ln *listener) steer(steering ReusePortSteering, n int) error {
+	switch steering {
+	case SteerByCPU:
+		return socket.SetReuseportCPUSteering(ln.fd, n)
+	case SteerByHash:
+		return socket.SetReuseportHashSteering(ln.fd, n)
+	default:
+		return nil
+	}
+}
+
 func (ln *listener) close() {
 	ln.once.Do(
 		func() {
 			if ln.fd > 0 {
 				logging.Error(os.NewSyscallError("close", unix.Close(ln.fd)))
 			}
-			if ln.network == "unix" {
+			if ln.isUnixFile() {
 				logging.Error(os.RemoveAll(ln.address))
 			}
 		})
@@ -100,6 +132,7 @@ func initListener(network, addr string, options *Options) (l *listener, err erro
 		sockOpt := socket.Option{SetSockOpt: socket.SetSendBuffer, Opt: options.SocketSendBuffer}
 		sockOpts = append(sockOpts, sockOpt)
 	}
+	sockOpts = append(sockOpts, listenerSockOpts(network, options)...)
 	if strings.HasPrefix(network, "udp") {
 		udpAddr, err := net.ResolveUDPAddr(network, addr)
 		if err == nil && udpAddr.IP.IsMulticast() {
@@ -109,7 +142,25 @@ func initListener(network, addr string, options *Options) (l *listener, err erro
 			}
 		}
 	}
-	l = &listener{network: network, address: addr, sockOpts: sockOpts}
+	if control := options.ListenerControl; control != nil {
+		// Keep it the last one so that it sees the socket with all the options above.
+		sockOpt := socket.Option{SetSockOpt: func(fd, _ int) error { return control(network, addr, fd) }}
+		sockOpts = append(sockOpts, sockOpt)
+	}
+	l = &listener{network: network, address: addr, sockOpts: sockOpts, sockFile: options.UnixSocketFile}
 	err = l.normalize()
 	return
 }
+
+// apply sets the permission and ownership on the socket file.
+func (f *UnixSocketFile) apply(path string) error {
+	if f.Perm != 0 {
+		if err := os.Chmod(path, f.Perm); err != nil {
+			return err
+		}
+	}
+	if f.Chown && (f.UID >= 0 || f.GID >= 0) {
+		return os.Lchown(path, f.UID, f.GID)
+	}
+	return nil
+}
@@ -95,8 +95,8 @@ func (l *listener) close() {
 
 func initListener(network, addr string, options *Options) (l *listener, err error) {
 	lc := net.ListenConfig{
-		Control: func(network, address string, c syscall.RawConn) error {
-			return c.Control(func(fd uintptr) {
+		Control: func(network, address string, c syscall.RawConn) (err error) {
+			e := c.Control(func(fd uintptr) {
 				if network != "unix" && (options.ReuseAddr || options.ReusePort) {
 					_ = windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_REUSEADDR, 1)
 				}
@@ -109,7 +109,14 @@ func initListener(network, addr string, options *Options) (l *listener, err erro
 				if options.SocketSendBuffer > 0 {
 					_ = windows.SetsockoptInt(windows.Handle(fd), windows.SOL_SOCKET, windows.SO_SNDBUF, options.SocketSendBuffer)
 				}
+				if options.ListenerControl != nil {
+					err = options.ListenerControl(network, address, int(fd))
+				}
 			})
+			if e != nil {
+				return e
+			}
+			return
 		},
 		KeepAlive: options.TCPKeepAlive,
 	}
@@ -36,6 +36,35 @@ const (
 	SourceAddrHash
 )
 
+// LoopStats is a snapshot of the load of an event-loop, it's passed to LoadBalancer.Next.
+type LoopStats struct {
+	// Index is the index of the event-loop in the engine.
+	Index int
+
+	// Connections is the number of active connections served by the event-loop, including the ones
+	// that have been assigned to it but not registered yet, e.g. the rest of an accepted batch.
+	Connections int
+
+	// PendingTasks is the number of asynchronous tasks queued up in the event-loop
+	// and waiting to be executed, it indicates how busy the event-loop is.
+	PendingTasks int
+}
+
+// LoadBalancer is the interface that a custom load-balancing strategy must implement,
+// it's installed by WithLoadBalancer and takes precedence over the LoadBalancing option.
+//
+// Note that Next is always invoked from the goroutine that accepts connections,
+// so the implementation doesn't need to be goroutine-safe unless it shares state
+// with other goroutines.
+type LoadBalancer interface {
+	// Next returns the index of the event-loop that the next accepted connection will be assigned to.
+	// The addr is the remote address of the new connection and loops holds the current stats of all
+	// event-loops, ordered by index. An index out of the range of loops is wrapped around.
+	//
+	// Note that loops is reused between invocations, don't retain it after Next returns.
+	Next(addr net.Addr, loops []LoopStats) int
+}
+
 type (
 	// loadBalancer is an interface which manipulates the event-loop set.
 	loadBalancer interface {
@@ -67,6 +96,13 @@ type (
 	sourceAddrHashLoadBalancer struct {
 		baseLoadBalancer
 	}
+
+	// customLoadBalancer with a user-defined LoadBalancer.
+	customLoadBalancer struct {
+		baseLoadBalancer
+		lb    LoadBalancer
+		stats []LoopStats
+	}
 )
 
 // ==================================== Implementation of base load-balancer ====================================
@@ -111,11 +147,13 @@ func (lb *roundRobinLoadBalancer) next(_ net.Addr) (el *eventloop) {
 
 // ================================= Implementation of Least-Connections load-balancer =================================
 
+// next returns the event-loop with the fewest connections, including the ones assigned to it
+// but not registered yet, so that a batch of accepted connections is spread across event-loops.
 func (lb *leastConnectionsLoadBalancer) next(_ net.Addr) (el *eventloop) {
 	el = lb.eventLoops[0]
-	minN := el.countConn()
+	minN := el.countConn() + el.countAssigned()
 	for _, v := range lb.eventLoops[1:] {
-		if n := v.countConn(); n < minN {
+		if n := v.countConn() + v.countAssigned(); n < minN {
 			minN = n
 			el = v
 		}
@@ -139,3 +177,22 @@ func (lb *sourceAddrHashLoadBalancer) next(netAddr net.Addr) *eventloop {
 	hashCode := lb.hash(netAddr.String())
 	return lb.eventLoops[hashCode%lb.size]
 }
+
+// ====================================== Implementation of custom load-balancer =======================================
+
+// next returns the event-loop chosen by the user-defined LoadBalancer.
+func (lb *customLoadBalancer) next(netAddr net.Addr) *eventloop {
+	lb.stats = lb.stats[:0]
+	for i, el := range lb.eventLoops {
+		lb.stats = append(lb.stats, LoopStats{
+			Index:        i,
+			Connections:  int(el.countConn() + el.countAssigned()),
+			PendingTasks: el.countPendingTasks(),
+		})
+	}
+	i := lb.lb.Next(netAddr, lb.stats) % lb.size
+	if i < 0 {
+		i += lb.size
+	}
+	return lb.eventLoops[i]
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"context"
+	"sync"
+
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
+	"github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// TaskPriority is the priority of a task submitted to an event-loop, it's ignored on Windows
+// where the tasks are run in the order they're submitted along with the other events.
+type TaskPriority int
+
+const (
+	// TaskPriorityLow is for the tasks that won't matter much even if they are deferred a little bit,
+	// the event-loop only runs a limited number of them at a time to keep I/O events from starving.
+	TaskPriorityLow TaskPriority = iota
+
+	// TaskPriorityHigh is for the tasks expected to be run as soon as possible.
+	TaskPriorityHigh
+)
+
+// Task is a function that runs on the goroutine of an event-loop, it must not block.
+type Task func() (result interface{}, err error)
+
+// TaskCallback receives the result of a Task, it's invoked on the goroutine of the event-loop
+// right after the Task returns.
+type TaskCallback func(result interface{}, err error)
+
+// Future is the pending result of a Task. If the event-loop stops before running the Task,
+// the Future is done with errors.ErrEngineShutdown.
+type Future struct {
+	once   sync.Once
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func (f *Future) complete(result interface{}, err error) {
+	f.once.Do(func() {
+		f.result, f.err = result, err
+		close(f.done)
+	})
+}
+
+// pendingFutures keeps track of the Futures whose Tasks are queued up in an event-loop,
+// they are failed with errors.ErrEngineShutdown once the event-loop stops.
+type pendingFutures struct {
+	mu      sync.Mutex
+	stopped bool
+	futures map[*Future]struct{}
+}
+
+// add tracks f, it reports false if the event-loop has stopped.
+func (p *pendingFutures) add(f *Future) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return false
+	}
+	if p.futures == nil {
+		p.futures = make(map[*Future]struct{})
+	}
+	p.futures[f] = struct{}{}
+	return true
+}
+
+func (p *pendingFutures) remove(f *Future) {
+	p.mu.Lock()
+	delete(p.futures, f)
+	p.mu.Unlock()
+}
+
+func (p *pendingFutures) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped
+}
+
+// stop fails the Futures left in the queue of the stopped event-loop.
+func (p *pendingFutures) stop() {
+	p.mu.Lock()
+	futures := p.futures
+	p.futures, p.stopped = nil, true
+	p.mu.Unlock()
+	for f := range futures {
+		f.complete(nil, errors.ErrEngineShutdown)
+	}
+}
+
+// Done returns a channel that is closed when the Task is done.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get waits for the Task to be done and returns its result, or returns the error of ctx
+// if ctx is done first. Don't call it on the goroutine of the event-loop that runs the Task,
+// it would block forever.
+func (f *Future) Get(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// LoopInfo provides the information and the user-defined context of an event-loop.
+type LoopInfo interface {
+	// Index returns the index of the event-loop, it's goroutine-safe.
+	Index() int
+
+	// Context returns the user-defined context of the event-loop, it's not goroutine-safe,
+	// you must invoke it on the goroutine of the event-loop, e.g. within OnLoopStart, OnLoopStop,
+	// a Task or any method in EventHandler for the connections of the event-loop.
+	Context() (ctx interface{})
+
+	// SetContext sets the user-defined context of the event-loop, it's not goroutine-safe,
+	// you must invoke it on the goroutine of the event-loop.
+	SetContext(ctx interface{})
+
+	// Submit is the same as Loop.Submit.
+	Submit(priority TaskPriority, task Task, callback TaskCallback) error
+
+	// Execute is the same as Loop.Execute.
+	Execute(priority TaskPriority, task Task) *Future
+}
+
+// Loop is the handle of an event-loop which runs tasks on the goroutine of the event-loop,
+// next to the connections it serves. The state that is only accessed by the tasks of an
+// event-loop and the event handlers of its connections doesn't need to be locked.
+//
+// All methods of Loop are goroutine-safe except Context and SetContext.
+type Loop struct {
+	el *eventloop
+}
+
+var _ LoopInfo = Loop{}
+
+// Index returns the index of the event-loop.
+func (l Loop) Index() int {
+	return l.el.idx
+}
+
+// Context returns the user-defined context of the event-loop.
+func (l Loop) Context() interface{} {
+	return l.el.ctx
+}
+
+// SetContext sets the user-defined context of the event-loop.
+func (l Loop) SetContext(ctx interface{}) {
+	l.el.ctx = ctx
+}
+
+// Submit runs the task asynchronously on the event-loop with the given priority,
+// callback is invoked with the result of the task if it's not nil.
+//
+// It returns errors.ErrEngineShutdown once the engine is shutting down, the tasks still queued
+// up when the event-loop stops are discarded without invoking their callbacks, use Execute
+// to be notified of that.
+func (l Loop) Submit(priority TaskPriority, task Task, callback TaskCallback) error {
+	return l.el.submit(priority, func() {
+		result, err := task()
+		if callback != nil {
+			callback(result, err)
+		}
+	})
+}
+
+// Execute runs the task asynchronously on the event-loop with the given priority
+// and returns the Future of its result.
+func (l Loop) Execute(priority TaskPriority, task Task) *Future {
+	f := newFuture()
+	if !l.el.futures.add(f) {
+		f.complete(nil, errors.ErrEngineShutdown)
+		return f
+	}
+	err := l.Submit(priority, task, func(result interface{}, err error) {
+		l.el.futures.remove(f)
+		f.complete(result, err)
+	})
+	if err != nil {
+		l.el.futures.remove(f)
+		f.complete(nil, err)
+	}
+	return f
+}
+
+// Loop returns the event-loop of the given index.
+//
+// The event-loops are available once the engine has booted, thus it can't be called in OnBoot.
+func (e Engine) Loop(idx int) (Loop, error) {
+	if err := e.Validate(); err != nil {
+		return Loop{}, err
+	}
+	if e.eng.eventLoops == nil || idx < 0 || idx >= e.eng.eventLoops.len() {
+		return Loop{}, errors.ErrInvalidLoopIndex
+	}
+	return Loop{e.eng.eventLoops.index(idx)}, nil
+}
+
+// Execute runs the task asynchronously on the event-loop of the given index with the given priority
+// and returns the Future of its result.
+func (e Engine) Execute(loopIdx int, priority TaskPriority, task Task) *Future {
+	l, err := e.Loop(loopIdx)
+	if err != nil {
+		f := newFuture()
+		f.complete(nil, err)
+		return f
+	}
+	return l.Execute(priority, task)
+}
+
+// Broadcast runs the task asynchronously on every event-loop with the given priority
+// and returns the Futures of results in the order of event-loop indices.
+func (e Engine) Broadcast(priority TaskPriority, task Task) ([]*Future, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	futures := make([]*Future, 0, e.eng.eventLoops.len())
+	e.eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		futures = append(futures, Loop{el}.Execute(priority, task))
+		return true
+	})
+	return futures, nil
+}
+
+func (el *eventloop) onLoopStart() {
+	if h, ok := el.eventHandler.(LoopHandler); ok {
+		h.OnLoopStart(Loop{el})
+	}
+}
+
+func (el *eventloop) onLoopStop() {
+	// No more tasks will be run, fail the ones left in the queue.
+	el.futures.stop()
+	if h, ok := el.eventHandler.(LoopHandler); ok {
+		h.OnLoopStop(Loop{el})
+	}
+	// The connections are all closed by now, give the cached memory back to the allocator.
+	if cache, ok := el.alloc.(allocator.Cache); ok {
+		cache.Flush()
+	}
+}
+
+// newLoopAllocator returns the allocator of buffers for the connections on an event-loop.
+func newLoopAllocator(opts *Options) allocator.BufferAllocator {
+	if a, ok := opts.BufferAllocator.(allocator.CachingAllocator); ok {
+		return a.NewCache()
+	}
+	return opts.BufferAllocator
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import "sync/atomic"
+
+// MemoryLimitPolicy is the action taken by the engine when the bytes held in the buffers of connections
+// exceed Options.MemoryLimit.
+type MemoryLimitPolicy int
+
+const (
+	// MemoryLimitPauseReads stops reading the connections until the memory usage falls below the limit,
+	// the data that has been read remains in the inbound buffers until the handler consumes it,
+	// OnTraffic keeps being invoked periodically for the paused connections holding inbound data
+	// so that the handler is able to drain it.
+	MemoryLimitPauseReads MemoryLimitPolicy = iota
+
+	// MemoryLimitRejectAsyncWrites fails Conn.AsyncWrite and Conn.AsyncWritev with
+	// errors.ErrMemoryLimitExceeded.
+	MemoryLimitRejectAsyncWrites
+
+	// MemoryLimitCloseLargest closes the connection that holds the most bytes across all event-loops
+	// whenever a connection is about to be read, the connection is closed with errors.ErrMemoryLimitExceeded
+	// by the event-loop it belongs to.
+	MemoryLimitCloseLargest
+)
+
+// String returns the description of the memory limit policy.
+func (p MemoryLimitPolicy) String() string {
+	switch p {
+	case MemoryLimitPauseReads:
+		return "pause reads"
+	case MemoryLimitRejectAsyncWrites:
+		return "reject async writes"
+	case MemoryLimitCloseLargest:
+		return "close largest"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats is a snapshot of the runtime statistics of engine.
+type Stats struct {
+	// Connections is the number of active connections.
+	Connections int
+
+	// InboundBytes is the number of bytes held in the inbound buffers of all connections.
+	InboundBytes int64
+
+	// OutboundBytes is the number of bytes held in the outbound buffers of all connections.
+	OutboundBytes int64
+
+	// MemoryLimit is the limit of InboundBytes plus OutboundBytes, 0 means unlimited.
+	MemoryLimit int64
+}
+
+// MemoryUsage returns the total number of bytes held in the buffers of connections.
+func (s Stats) MemoryUsage() int64 {
+	return s.InboundBytes + s.OutboundBytes
+}
+
+// Stats returns the runtime statistics of engine.
+//
+// The bytes held in buffers are updated as the connections are read and written by the event-loops,
+// thus they're approximate, they're always 0 on Windows.
+func (e Engine) Stats() (s Stats, err error) {
+	if err = e.Validate(); err != nil {
+		return
+	}
+
+	e.eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		in, out := el.memoryUsage()
+		s.Connections += int(el.countConn())
+		s.InboundBytes += in
+		s.OutboundBytes += out
+		return true
+	})
+	s.MemoryLimit = e.eng.opts.MemoryLimit
+	return
+}
+
+// memoryExceeded reports whether the bytes held in buffers across all event-loops exceed the limit.
+func (eng *engine) memoryExceeded() bool {
+	limit := eng.opts.MemoryLimit
+	return limit > 0 && atomic.LoadInt64(&eng.memoryUsed) > limit
+}
+
+// rejectAsyncWrite reports whether the asynchronous writes ought to be rejected for the memory limit.
+func (eng *engine) rejectAsyncWrite() bool {
+	return eng.opts.MemoryLimitPolicy == MemoryLimitRejectAsyncWrites && eng.memoryExceeded()
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || dragonfly || netbsd || openbsd || darwin
+// +build linux freebsd dragonfly netbsd openbsd darwin
+
+package gnet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/panjf2000/gnet/v2/internal/queue"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func (el *eventloop) memoryUsage() (inbound, outbound int64) {
+	return atomic.LoadInt64(&el.inboundBytes), atomic.LoadInt64(&el.outboundBytes)
+}
+
+// account updates the event-loop with the bytes held in the buffers of connection.
+func (c *conn) account() {
+	var freed bool
+	if in := int64(c.inboundBuffer.Buffered()); in != c.inboundHeld {
+		atomic.AddInt64(&c.loop.inboundBytes, in-c.inboundHeld)
+		atomic.AddInt64(&c.loop.engine.memoryUsed, in-c.inboundHeld)
+		freed = in < c.inboundHeld
+		c.inboundHeld = in
+	}
+	if out := int64(c.outboundBuffer.Buffered()); out != c.outboundHeld {
+		atomic.AddInt64(&c.loop.outboundBytes, out-c.outboundHeld)
+		atomic.AddInt64(&c.loop.engine.memoryUsed, out-c.outboundHeld)
+		freed = freed || out < c.outboundHeld
+		c.outboundHeld = out
+	}
+	if freed {
+		c.loop.engine.checkPausedReads()
+	}
+}
+
+// unaccount removes the bytes held by the connection from the event-loop when it's closed.
+func (c *conn) unaccount() {
+	if c.inboundHeld == 0 && c.outboundHeld == 0 {
+		return
+	}
+	atomic.AddInt64(&c.loop.inboundBytes, -c.inboundHeld)
+	atomic.AddInt64(&c.loop.outboundBytes, -c.outboundHeld)
+	atomic.AddInt64(&c.loop.engine.memoryUsed, -(c.inboundHeld + c.outboundHeld))
+	c.inboundHeld, c.outboundHeld = 0, 0
+	c.loop.engine.checkPausedReads()
+}
+
+// enforceMemoryLimit applies the memory limit policy before reading the connection,
+// it reports whether the connection can be read.
+func (el *eventloop) enforceMemoryLimit(c *conn) (bool, error) {
+	// Only the exceptional events are reported for the paused connection, read it to find out the error.
+	if c.readPaused || !el.engine.memoryExceeded() {
+		return true, nil
+	}
+
+	switch el.engine.opts.MemoryLimitPolicy {
+	case MemoryLimitPauseReads:
+		return false, el.pauseRead(c)
+	case MemoryLimitCloseLargest:
+		el.engine.closeLargest()
+		return true, nil
+	default:
+		return true, nil
+	}
+}
+
+// largestConn returns the connection that holds the most bytes on the event-loop,
+// connections holding nothing are never returned.
+func (el *eventloop) largestConn() (largest *conn, held int64) {
+	el.connections.iterate(func(c *conn) bool {
+		if n := c.inboundHeld + c.outboundHeld; n > held {
+			largest, held = c, n
+		}
+		return true
+	})
+	return
+}
+
+// memoryHolder is the connection that holds the most bytes on an event-loop.
+type memoryHolder struct {
+	el   *eventloop
+	c    *conn
+	held int64
+}
+
+// closeLargest closes the connection that holds the most bytes across all event-loops with
+// errors.ErrMemoryLimitExceeded, the connections are inspected and closed by the event-loops
+// they belong to, only one connection is closed at a time.
+func (eng *engine) closeLargest() {
+	if !atomic.CompareAndSwapInt32(&eng.closingLargest, 0, 1) {
+		return
+	}
+
+	n := eng.eventLoops.len()
+	holders := make(chan memoryHolder, n)
+	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		err := el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
+			c, held := el.largestConn()
+			holders <- memoryHolder{el, c, held}
+			return nil
+		}, nil)
+		if err != nil {
+			holders <- memoryHolder{}
+		}
+		return true
+	})
+
+	go func() {
+		var largest memoryHolder
+		for i := 0; i < n; i++ {
+			select {
+			case h := <-holders:
+				if h.held > largest.held {
+					largest = h
+				}
+			case <-eng.workerPool.shutdownCtx.Done():
+				return // leave closingLargest set as the engine is shutting down
+			}
+		}
+		if largest.c == nil {
+			atomic.StoreInt32(&eng.closingLargest, 0)
+			return
+		}
+
+		el, c := largest.el, largest.c
+		err := el.poller.Trigger(queue.HighPriority, func(_ interface{}) error {
+			defer atomic.StoreInt32(&eng.closingLargest, 0)
+			if c.inboundHeld+c.outboundHeld == 0 || !eng.memoryExceeded() {
+				return nil
+			}
+			return el.close(c, errorx.ErrMemoryLimitExceeded)
+		}, nil)
+		if err != nil {
+			atomic.StoreInt32(&eng.closingLargest, 0)
+		}
+	}()
+}
+
+// pauseRead stops reading the connection until the memory usage falls below the limit.
+func (el *eventloop) pauseRead(c *conn) error {
+	if c.readPaused {
+		return nil
+	}
+	c.readPaused = true
+	el.paused = append(el.paused, c)
+	atomic.StoreInt32(&el.engine.readsPaused, 1)
+	if err := c.stopReading(); err != nil {
+		return err
+	}
+	// The memory may have been freed by other event-loops since the limit was checked,
+	// before readsPaused was set, in which case nobody else would resume the reading.
+	el.engine.checkPausedReads()
+	if !c.inboundBuffer.IsEmpty() {
+		el.scheduleRedelivery()
+	}
+	return nil
+}
+
+// redeliveryInterval is the interval at which OnTraffic is invoked again for the paused connections
+// that still hold inbound data.
+const redeliveryInterval = 10 * time.Millisecond
+
+// scheduleRedelivery arranges for the paused connections to receive OnTraffic again, nothing else
+// wakes them up while they're not read, which would leave the memory held by their inbound data
+// unreclaimable when the limit is exceeded by it.
+func (el *eventloop) scheduleRedelivery() {
+	if el.redelivering {
+		return
+	}
+	el.redelivering = true
+	time.AfterFunc(redeliveryInterval, func() {
+		_ = el.poller.Trigger(queue.LowPriority, el.redeliver, nil)
+	})
+}
+
+// redeliver invokes OnTraffic for the paused connections on the event-loop that still hold inbound data.
+func (el *eventloop) redeliver(_ interface{}) error {
+	el.redelivering = false
+	var pending bool
+	for _, c := range el.paused {
+		if !c.opened || !c.readPaused || c.inboundBuffer.IsEmpty() {
+			continue
+		}
+		if err := el.wake(c); err != nil {
+			return err
+		}
+		pending = pending || (c.opened && c.readPaused && !c.inboundBuffer.IsEmpty())
+	}
+	if pending {
+		el.scheduleRedelivery()
+	}
+	return nil
+}
+
+// resumeReads resumes reading the connections paused on the event-loop.
+func (el *eventloop) resumeReads(_ interface{}) error {
+	paused := el.paused
+	el.paused = nil
+	for _, c := range paused {
+		if !c.opened || !c.readPaused {
+			continue // ignore stale connections
+		}
+		c.readPaused = false
+		if err := c.startReading(); err != nil {
+			el.getLogger().Errorf("failed to resume reading connection(fd=%d) in event-loop(%d): %v", c.fd, el.idx, err)
+		}
+	}
+	return nil
+}
+
+// checkPausedReads resumes reading the paused connections on all event-loops
+// once the memory usage falls below the limit.
+func (eng *engine) checkPausedReads() {
+	if atomic.LoadInt32(&eng.readsPaused) == 0 || eng.memoryExceeded() ||
+		!atomic.CompareAndSwapInt32(&eng.readsPaused, 1, 0) {
+		return
+	}
+	eng.eventLoops.iterate(func(_ int, el *eventloop) bool {
+		if err := el.poller.Trigger(queue.LowPriority, el.resumeReads, nil); err != nil {
+			eng.opts.Logger.Errorf("failed to resume reading connections in event-loop(%d): %v", el.idx, err)
+		}
+		return true
+	})
+}
@@ -15,8 +15,12 @@
 package gnet
 
 import (
+	"os"
+	"runtime"
 	"time"
 
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
+	"github.com/panjf2000/gnet/v2/pkg/errors"
 	"github.com/panjf2000/gnet/v2/pkg/logging"
 )
 
@@ -31,6 +35,19 @@ func loadOptions(options ...Option) *Options {
 	return opts
 }
 
+// checkSockOpts rejects the Linux-specific socket options on the other platforms up front,
+// rather than failing them on every accepted or dialed connection.
+func checkSockOpts(opts *Options) error {
+	if runtime.GOOS == "linux" {
+		return nil
+	}
+	if opts.TCPFastOpen > 0 || opts.TCPUserTimeout > 0 || opts.TCPQuickAck ||
+		opts.TCPDeferAccept > 0 || opts.SocketBusyPoll > 0 {
+		return errors.ErrUnsupportedOp
+	}
+	return nil
+}
+
 // TCPSocketOpt is the type of TCP socket options.
 type TCPSocketOpt int
 
@@ -40,6 +57,55 @@ const (
 	TCPDelay
 )
 
+// ReusePortSteering is the policy of distributing incoming connections among
+// the SO_REUSEPORT listeners of event-loops.
+type ReusePortSteering int
+
+// Available policies of steering connections with SO_REUSEPORT.
+const (
+	// SteerByKernel leaves the distribution to the built-in hash of kernel.
+	SteerByKernel ReusePortSteering = iota
+
+	// SteerByCPU dispatches a connection to the event-loop whose index equals the number of CPU
+	// handling the incoming packet modulo the number of event-loops, it works best along with
+	// LockOSThread and event-loops that are pinned to CPUs.
+	SteerByCPU
+
+	// SteerByHash dispatches a connection to the event-loop whose index equals the receive hash
+	// of the incoming packet modulo the number of event-loops.
+	SteerByHash
+)
+
+// SocketOption is a generic integer socket option passed to setsockopt(2).
+type SocketOption struct {
+	Level int // the protocol level, e.g. unix.SOL_SOCKET or unix.IPPROTO_TCP
+	Name  int // the option name, e.g. unix.SO_MARK
+	Value int // the option value
+}
+
+// ListenerControl is called with the raw file descriptor of a listener after the socket is created
+// and its options are set, but before it's bound to the address, like net.ListenConfig.Control.
+// The network and address are the ones that the engine listens on, returning an error aborts
+// the start of engine.
+type ListenerControl func(network, address string, fd int) error
+
+// ConnControl is called with the raw file descriptor of a new connection right after it's accepted,
+// before it's handed off to an event-loop. The address is the remote address of connection,
+// returning an error closes the connection.
+type ConnControl func(network, address string, fd int) error
+
+// UnixSocketFile describes the permission and ownership of the socket file of a unix domain socket listener,
+// they are applied after the socket is bound and before it starts listening, so that no one is able to
+// connect to it in between. It doesn't apply to the abstract namespace.
+//
+// The ownership is only changed when Chown is set, so that the zero value leaves it as is.
+type UnixSocketFile struct {
+	Perm  os.FileMode // permission bits, 0 leaves it to the umask of process
+	Chown bool        // change the ownership to UID and GID
+	UID   int         // user ID of the owner, -1 leaves it unchanged
+	GID   int         // group ID of the owner, -1 leaves it unchanged
+}
+
 // Options are configurations for the gnet application.
 type Options struct {
 	// ================================== Options for only server-side ==================================
@@ -57,18 +123,70 @@ type Options struct {
 	// LB represents the load-balancing algorithm used when assigning new connections.
 	LB LoadBalancing
 
+	// LoadBalancer is a custom load-balancing strategy used when assigning new connections.
+	// Note: Setting up LoadBalancer will override LB.
+	LoadBalancer LoadBalancer
+
 	// ReuseAddr indicates whether to set up the SO_REUSEADDR socket option.
 	ReuseAddr bool
 
 	// ReusePort indicates whether to set up the SO_REUSEPORT socket option.
+	// Each event-loop binds its own listener when it is enabled.
 	ReusePort bool
 
+	// ReusePortSteering attaches a classic BPF program (SO_ATTACH_REUSEPORT_CBPF) to the SO_REUSEPORT
+	// listeners of event-loops for steering the incoming connections in kernel.
+	// It's ignored without ReusePort and only supported on Linux, Run fails with
+	// errors.ErrUnsupportedOp when it's set along with ReusePort on BSD-like OSs.
+	ReusePortSteering ReusePortSteering
+
 	// MulticastInterfaceIndex is the index of the interface name where the multicast UDP addresses will be bound to.
 	MulticastInterfaceIndex int
 
+	// MaxConnections is the maximum number of active connections that the engine serves at the same time,
+	// any new connection beyond this limit will be rejected. Zero means no limit.
+	MaxConnections int
+
+	// MaxConnectionsPerIP is the maximum number of active connections from the same source IP,
+	// any new connection beyond this limit will be rejected. Zero means no limit.
+	MaxConnectionsPerIP int
+
+	// AcceptRate is the maximum number of new connections accepted per second, it is enforced
+	// by a token-bucket whose capacity is AcceptBurst. Zero means no limit.
+	AcceptRate int
+
+	// AcceptBurst is the maximum number of new connections that can be accepted at once,
+	// it defaults to AcceptRate.
+	AcceptBurst int
+
+	// ProxyProtocol indicates whether the accepted stream connections start with a PROXY protocol header,
+	// the header is consumed before OnOpen fires and the addresses carried by it are returned by
+	// Conn.LocalAddr and Conn.RemoteAddr.
+	ProxyProtocol ProxyProtocolMode
+
+	// ProxyProtocolTimeout is the maximum duration of waiting for the PROXY protocol header,
+	// it defaults to DefaultProxyProtocolTimeout. Under ProxyProtocolOptional, it's also how long
+	// OnOpen is delayed for the connections whose clients wait for the server to speak first.
+	ProxyProtocolTimeout time.Duration
+
+	// AllowedCIDRs is the list of source IPs in CIDR notation that are allowed to connect to the engine
+	// or send UDP packets to it, all source IPs are allowed if it is empty. It can be replaced at runtime
+	// via Engine.UpdateAccessControl.
+	AllowedCIDRs []string
+
+	// DeniedCIDRs is the list of source IPs in CIDR notation that are denied, it takes precedence
+	// over AllowedCIDRs. It can be replaced at runtime via Engine.UpdateAccessControl.
+	DeniedCIDRs []string
+
+	// RejectPayload is the goodbye message sent to the peer before a rejected connection is closed,
+	// the connection is closed immediately if it is empty. It's sent with a single write that is never
+	// retried, so it's best-effort and may be cut short if it doesn't fit in the socket send buffer.
+	RejectPayload []byte
+
 	// ============================= Options for both server-side and client-side =============================
 
-	// ReadBufferCap is the maximum number of bytes that can be read from the peer when the readable event comes.
+	// ReadBufferCap is the maximum number of bytes that can be read from the peer at a time, a connection is read
+	// repeatedly when the readable event comes until it's drained or a few reads are done.
 	// The default value is 64KB, it can either be reduced to avoid starving the subsequent connections or increased
 	// to read more data from a socket.
 	//
@@ -76,6 +194,39 @@ type Options struct {
 	// or equal to its real amount.
 	ReadBufferCap int
 
+	// AdaptiveReadBuffer adjusts the number of bytes read at a time on each connection in terms of its recent reads,
+	// between 64 bytes and ReadBufferCap, rather than always reading up to ReadBufferCap.
+	AdaptiveReadBuffer bool
+
+	// ReadBudgetBytes is the maximum number of bytes read from a connection per readable event,
+	// the rest is read in the next round of polling. The default value is 0, which means unlimited.
+	ReadBudgetBytes int
+
+	// ReadBudgetReads is the maximum number of reads on a connection per readable event,
+	// the default value is 16.
+	ReadBudgetReads int
+
+	// LoopTrafficBudget is the maximum time that an event-loop spends on reading connections
+	// and firing OnTraffic per round of polling before it returns to polling, the readable connections
+	// that are not served in time will be served in the next round, so that one chatty connection can't
+	// starve the others on the same event-loop. The default value is 0, which means unlimited.
+	LoopTrafficBudget time.Duration
+
+	// MemoryLimit is the maximum number of bytes held in the inbound and outbound buffers of all connections
+	// across event-loops, MemoryLimitPolicy is applied when it's exceeded. The default value is 0,
+	// which means unlimited. It's not supported on Windows.
+	MemoryLimit int64
+
+	// MemoryLimitPolicy is the action taken when MemoryLimit is exceeded, the default policy is
+	// MemoryLimitPauseReads.
+	MemoryLimitPolicy MemoryLimitPolicy
+
+	// EdgeTriggered registers the connections to epoll in edge-triggered mode along with EPOLLRDHUP,
+	// the connections are read and written until EAGAIN on each event and the writable event is
+	// watched all along instead of being switched on and off with epoll_ctl as the outbound data
+	// piles up and drains. It's only available on Linux and ignored on other platforms.
+	EdgeTriggered bool
+
 	// WriteBufferCap is the maximum number of bytes that a static outbound buffer can hold,
 	// if the data exceeds this value, the overflow will be stored in the elastic linked list buffer.
 	// The default value is 64KB.
@@ -84,6 +235,11 @@ type Options struct {
 	// or equal to its real amount.
 	WriteBufferCap int
 
+	// BufferAllocator allocates the memory of the inbound and outbound buffers of connections,
+	// each event-loop gets its own cache if it's an allocator.CachingAllocator like allocator.Slab.
+	// The default is nil, which means the buffers take memory from the built-in sync.Pool based pools.
+	BufferAllocator allocator.BufferAllocator
+
 	// LockOSThread is used to determine whether each I/O event-loop is associated to an OS thread, it is useful when you
 	// need some kind of mechanisms like thread local storage, or invoke certain C libraries (such as graphics lib: GLib)
 	// that require thread-level manipulation via cgo, or want all I/O event-loops to actually run in parallel for a
@@ -93,9 +249,30 @@ type Options struct {
 	// Ticker indicates whether the ticker has been set up.
 	Ticker bool
 
+	// AcceptBatch is the maximum number of connections accepted on each readable event of listener,
+	// the connections accepted by the main reactor in one go are handed off to each sub-reactor
+	// in a single batch. It accepts one connection per event by default.
+	AcceptBatch int
+
+	// GracefulDrain indicates whether Engine.Stop drains the connections before shutting down the engine,
+	// see DrainHandler.
+	GracefulDrain bool
+
+	// LoopTicker indicates whether a ticker is set up for each event-loop, it takes effect
+	// only if the EventHandler implements LoopTickHandler.
+	LoopTicker bool
+
 	// TCPKeepAlive sets up a duration for (SO_KEEPALIVE) socket option.
 	TCPKeepAlive time.Duration
 
+	// TCPKeepAliveInterval sets up the interval between TCP keep-alive probes (TCP_KEEPINTVL),
+	// it takes effect along with TCPKeepAlive and defaults to one fifth of TCPKeepAlive.
+	TCPKeepAliveInterval time.Duration
+
+	// TCPKeepAliveCount sets up the number of unacknowledged TCP keep-alive probes before dropping
+	// the connection (TCP_KEEPCNT), it takes effect along with TCPKeepAlive and defaults to 5.
+	TCPKeepAliveCount int
+
 	// TCPNoDelay controls whether the operating system should delay
 	// packet transmission in hopes of sending fewer packets (Nagle's algorithm).
 	//
@@ -109,6 +286,37 @@ type Options struct {
 	// SocketSendBuffer sets the maximum socket send buffer in bytes.
 	SocketSendBuffer int
 
+	// TCPFastOpen sets up the length of the queue of pending TCP Fast Open requests on listener
+	// (TCP_FASTOPEN), it's only supported on Linux.
+	TCPFastOpen int
+
+	// TCPUserTimeout sets up the maximum time that transmitted data may remain unacknowledged before
+	// TCP closes the connection forcibly (TCP_USER_TIMEOUT), it's only supported on Linux.
+	TCPUserTimeout time.Duration
+
+	// TCPQuickAck enables the quick ACK mode (TCP_QUICKACK) on new connections, it's only supported on Linux.
+	TCPQuickAck bool
+
+	// TCPDeferAccept sets up the time that the listener waits for the first data of new connections
+	// before waking up the acceptor (TCP_DEFER_ACCEPT), it's only supported on Linux.
+	TCPDeferAccept time.Duration
+
+	// SocketBusyPoll sets up the time to busy poll on receiving when there is no data (SO_BUSY_POLL)
+	// for both listeners and connections, it's only supported on Linux.
+	SocketBusyPoll time.Duration
+
+	// SocketOptions are the generic socket options that are set on both listeners and connections.
+	SocketOptions []SocketOption
+
+	// ListenerControl is called on the raw file descriptor of listener before binding it.
+	ListenerControl ListenerControl
+
+	// ConnControl is called on the raw file descriptor of each accepted connection.
+	ConnControl ConnControl
+
+	// UnixSocketFile sets the permission and ownership of the socket file for unix domain socket listener.
+	UnixSocketFile *UnixSocketFile
+
 	// LogPath the local path where logs will be written, this is the easiest way to set up logging,
 	// gnet instantiates a default uber-go/zap logger with this given log path, you are also allowed to employ
 	// you own logger during the lifetime by implementing the following log.Logger interface.
@@ -152,6 +360,43 @@ func WithReadBufferCap(readBufferCap int) Option {
 	}
 }
 
+// WithAdaptiveReadBuffer enables the adaptive sizing of reads on each connection.
+func WithAdaptiveReadBuffer(adaptive bool) Option {
+	return func(opts *Options) {
+		opts.AdaptiveReadBuffer = adaptive
+	}
+}
+
+// WithReadBudget sets up the maximum number of bytes and reads on a connection per readable event.
+func WithReadBudget(bytes, reads int) Option {
+	return func(opts *Options) {
+		opts.ReadBudgetBytes = bytes
+		opts.ReadBudgetReads = reads
+	}
+}
+
+// WithLoopTrafficBudget sets up the maximum time spent on reading connections per round of polling.
+func WithLoopTrafficBudget(budget time.Duration) Option {
+	return func(opts *Options) {
+		opts.LoopTrafficBudget = budget
+	}
+}
+
+// WithMemoryLimit sets up the memory limit of the buffers of connections and the policy applied when it's exceeded.
+func WithMemoryLimit(limit int64, policy MemoryLimitPolicy) Option {
+	return func(opts *Options) {
+		opts.MemoryLimit = limit
+		opts.MemoryLimitPolicy = policy
+	}
+}
+
+// WithEdgeTriggered enables the edge-triggered mode of epoll for connections.
+func WithEdgeTriggered(edgeTriggered bool) Option {
+	return func(opts *Options) {
+		opts.EdgeTriggered = edgeTriggered
+	}
+}
+
 // WithWriteBufferCap sets up WriteBufferCap for pending bytes.
 func WithWriteBufferCap(writeBufferCap int) Option {
 	return func(opts *Options) {
@@ -159,6 +404,13 @@ func WithWriteBufferCap(writeBufferCap int) Option {
 	}
 }
 
+// WithBufferAllocator sets up the allocator of the buffers of connections.
+func WithBufferAllocator(alloc allocator.BufferAllocator) Option {
+	return func(opts *Options) {
+		opts.BufferAllocator = alloc
+	}
+}
+
 // WithLoadBalancing sets up the load-balancing algorithm in gnet engine.
 func WithLoadBalancing(lb LoadBalancing) Option {
 	return func(opts *Options) {
@@ -166,6 +418,13 @@ func WithLoadBalancing(lb LoadBalancing) Option {
 	}
 }
 
+// WithLoadBalancer sets up a custom load-balancing strategy in gnet engine.
+func WithLoadBalancer(lb LoadBalancer) Option {
+	return func(opts *Options) {
+		opts.LoadBalancer = lb
+	}
+}
+
 // WithNumEventLoop sets up NumEventLoop in gnet engine.
 func WithNumEventLoop(numEventLoop int) Option {
 	return func(opts *Options) {
@@ -180,6 +439,13 @@ func WithReusePort(reusePort bool) Option {
 	}
 }
 
+// WithReusePortSteering sets up the policy of steering connections among SO_REUSEPORT listeners.
+func WithReusePortSteering(steering ReusePortSteering) Option {
+	return func(opts *Options) {
+		opts.ReusePortSteering = steering
+	}
+}
+
 // WithReuseAddr sets up SO_REUSEADDR socket option.
 func WithReuseAddr(reuseAddr bool) Option {
 	return func(opts *Options) {
@@ -187,6 +453,64 @@ func WithReuseAddr(reuseAddr bool) Option {
 	}
 }
 
+// WithMaxConnections sets up the maximum number of active connections.
+func WithMaxConnections(maxConns int) Option {
+	return func(opts *Options) {
+		opts.MaxConnections = maxConns
+	}
+}
+
+// WithMaxConnectionsPerIP sets up the maximum number of active connections from the same source IP.
+func WithMaxConnectionsPerIP(maxConns int) Option {
+	return func(opts *Options) {
+		opts.MaxConnectionsPerIP = maxConns
+	}
+}
+
+// WithAcceptRate sets up the maximum number of new connections accepted per second
+// and the maximum number of new connections accepted at once.
+func WithAcceptRate(rate, burst int) Option {
+	return func(opts *Options) {
+		opts.AcceptRate = rate
+		opts.AcceptBurst = burst
+	}
+}
+
+// WithProxyProtocol sets up the mode of PROXY protocol.
+func WithProxyProtocol(mode ProxyProtocolMode) Option {
+	return func(opts *Options) {
+		opts.ProxyProtocol = mode
+	}
+}
+
+// WithProxyProtocolTimeout sets up the timeout of reading the PROXY protocol header.
+func WithProxyProtocolTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.ProxyProtocolTimeout = timeout
+	}
+}
+
+// WithAllowedCIDRs sets up the source IPs that are allowed.
+func WithAllowedCIDRs(cidrs ...string) Option {
+	return func(opts *Options) {
+		opts.AllowedCIDRs = cidrs
+	}
+}
+
+// WithDeniedCIDRs sets up the source IPs that are denied.
+func WithDeniedCIDRs(cidrs ...string) Option {
+	return func(opts *Options) {
+		opts.DeniedCIDRs = cidrs
+	}
+}
+
+// WithRejectPayload sets up the goodbye message sent to the rejected connections.
+func WithRejectPayload(payload []byte) Option {
+	return func(opts *Options) {
+		opts.RejectPayload = payload
+	}
+}
+
 // WithTCPKeepAlive sets up the SO_KEEPALIVE socket option with duration.
 func WithTCPKeepAlive(tcpKeepAlive time.Duration) Option {
 	return func(opts *Options) {
@@ -215,6 +539,99 @@ func WithSocketSendBuffer(sendBuf int) Option {
 	}
 }
 
+// WithTCPKeepAliveInterval sets up the interval between TCP keep-alive probes.
+func WithTCPKeepAliveInterval(interval time.Duration) Option {
+	return func(opts *Options) {
+		opts.TCPKeepAliveInterval = interval
+	}
+}
+
+// WithTCPKeepAliveCount sets up the number of unacknowledged TCP keep-alive probes before dropping the connection.
+func WithTCPKeepAliveCount(count int) Option {
+	return func(opts *Options) {
+		opts.TCPKeepAliveCount = count
+	}
+}
+
+// WithTCPFastOpen sets up the length of the queue of pending TCP Fast Open requests on listener.
+func WithTCPFastOpen(qlen int) Option {
+	return func(opts *Options) {
+		opts.TCPFastOpen = qlen
+	}
+}
+
+// WithTCPUserTimeout sets up the maximum time that transmitted data may remain unacknowledged.
+func WithTCPUserTimeout(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.TCPUserTimeout = timeout
+	}
+}
+
+// WithTCPQuickAck enables the quick ACK mode on new connections.
+func WithTCPQuickAck(quickAck bool) Option {
+	return func(opts *Options) {
+		opts.TCPQuickAck = quickAck
+	}
+}
+
+// WithTCPDeferAccept sets up the time that the listener waits for the first data of new connections.
+func WithTCPDeferAccept(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.TCPDeferAccept = timeout
+	}
+}
+
+// WithSocketBusyPoll sets up the time to busy poll on receiving for listeners and connections.
+func WithSocketBusyPoll(timeout time.Duration) Option {
+	return func(opts *Options) {
+		opts.SocketBusyPoll = timeout
+	}
+}
+
+// WithSocketOption appends a generic socket option that is set on both listeners and connections,
+// it can be used multiple times.
+func WithSocketOption(level, name, value int) Option {
+	return func(opts *Options) {
+		opts.SocketOptions = append(opts.SocketOptions, SocketOption{Level: level, Name: name, Value: value})
+	}
+}
+
+// WithListenerControl sets up a function that is called on the raw file descriptor of listener before binding it.
+func WithListenerControl(control ListenerControl) Option {
+	return func(opts *Options) {
+		opts.ListenerControl = control
+	}
+}
+
+// WithConnControl sets up a function that is called on the raw file descriptor of each accepted connection.
+func WithConnControl(control ConnControl) Option {
+	return func(opts *Options) {
+		opts.ConnControl = control
+	}
+}
+
+// WithUnixSocketPerm sets the permission bits of the socket file for unix domain socket listener.
+func WithUnixSocketPerm(perm os.FileMode) Option {
+	return func(opts *Options) {
+		if opts.UnixSocketFile == nil {
+			opts.UnixSocketFile = &UnixSocketFile{}
+		}
+		opts.UnixSocketFile.Perm = perm
+	}
+}
+
+// WithUnixSocketOwner sets the owner and group of the socket file for unix domain socket listener,
+// -1 leaves the respective one unchanged.
+func WithUnixSocketOwner(uid, gid int) Option {
+	return func(opts *Options) {
+		if opts.UnixSocketFile == nil {
+			opts.UnixSocketFile = &UnixSocketFile{}
+		}
+		opts.UnixSocketFile.Chown = true
+		opts.UnixSocketFile.UID, opts.UnixSocketFile.GID = uid, gid
+	}
+}
+
 // WithTicker indicates that a ticker is set.
 func WithTicker(ticker bool) Option {
 	return func(opts *Options) {
@@ -222,6 +639,27 @@ func WithTicker(ticker bool) Option {
 	}
 }
 
+// WithAcceptBatch sets up the maximum number of connections accepted on each readable event of listener.
+func WithAcceptBatch(n int) Option {
+	return func(opts *Options) {
+		opts.AcceptBatch = n
+	}
+}
+
+// WithGracefulDrain sets up graceful draining of connections for Engine.Stop.
+func WithGracefulDrain(drain bool) Option {
+	return func(opts *Options) {
+		opts.GracefulDrain = drain
+	}
+}
+
+// WithLoopTicker indicates that a ticker is set for each event-loop.
+func WithLoopTicker(ticker bool) Option {
+	return func(opts *Options) {
+		opts.LoopTicker = ticker
+	}
+}
+
 // WithLogPath is an option to set up the local path of log file.
 func WithLogPath(fileName string) Option {
 	return func(opts *Options) {
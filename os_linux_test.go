@@ -0,0 +1,502 @@
+//go:build linux
+// +build linux
+
+package gnet
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestReusePortSteering(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		testReusePortSteering(t, "tcp", "127.0.0.1:9972")
+	})
+	t.Run("tcp4", func(t *testing.T) {
+		testReusePortSteering(t, "tcp4", "127.0.0.1:9973")
+	})
+}
+
+type testReusePortSteeringServer struct {
+	scenarioServer
+	nclients int32
+	opened   int32
+}
+
+func (s *testReusePortSteeringServer) OnOpen(c Conn) (out []byte, action Action) {
+	// The client is pinned to CPU 0 and loopback packets are handled by the CPU of sender,
+	// thus all connections ought to be steered to the first event-loop.
+	assert.Equal(s.tester, 0, c.(*conn).loop.idx, "connection should be steered to the first event-loop")
+	atomic.AddInt32(&s.opened, 1)
+	return
+}
+
+func (s *testReusePortSteeringServer) run() {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var set unix.CPUSet
+	set.Set(0)
+	require.NoError(s.tester, unix.SchedSetaffinity(0, &set))
+	for i := int32(0); i < s.nclients; i++ {
+		c, err := net.Dial(s.network, s.addr)
+		require.NoError(s.tester, err)
+		defer c.Close() //nolint:errcheck
+	}
+	require.Eventually(s.tester, func() bool {
+		return atomic.LoadInt32(&s.opened) == s.nclients
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func testReusePortSteering(t *testing.T, network, addr string) {
+	svr := &testReusePortSteeringServer{scenarioServer: scenarioServer{tester: t, network: network, addr: addr, async: true}, nclients: 16}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithNumEventLoop(4),
+		WithReusePort(true),
+		WithReusePortSteering(SteerByCPU))
+	assert.NoError(t, err)
+	assert.EqualValues(t, svr.nclients, atomic.LoadInt32(&svr.opened))
+}
+
+func TestSocketOptions(t *testing.T) {
+	svr := &testSocketOptionsServer{scenarioServer: scenarioServer{tester: t, network: "tcp", addr: "127.0.0.1:9964", async: true}}
+	svr.scenario = svr.run
+	err := Run(svr, svr.network+"://"+svr.addr, svr.options()...)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&svr.opened))
+}
+
+type testSocketOptionsServer struct {
+	scenarioServer
+	opened int32
+}
+
+func (s *testSocketOptionsServer) options() []Option {
+	return []Option{
+		WithTicker(true),
+		WithTCPKeepAlive(10 * time.Second),
+		WithTCPKeepAliveInterval(2 * time.Second),
+		WithTCPKeepAliveCount(3),
+		WithTCPUserTimeout(3 * time.Second),
+		WithTCPQuickAck(true),
+		WithTCPFastOpen(16),
+		WithTCPDeferAccept(time.Second),
+		WithSocketOption(unix.SOL_SOCKET, unix.SO_PRIORITY, 5),
+	}
+}
+
+func assertSockOpt(t *testing.T, fd, level, name, expected int) {
+	v, err := unix.GetsockoptInt(fd, level, name)
+	require.NoError(t, err)
+	assert.Equal(t, expected, v, "level: %d, name: %d", level, name)
+}
+
+func assertConnSockOpts(t *testing.T, fd int) {
+	assertSockOpt(t, fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1)
+	assertSockOpt(t, fd, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE, 10)
+	assertSockOpt(t, fd, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, 2)
+	assertSockOpt(t, fd, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, 3)
+	assertSockOpt(t, fd, unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, 3000)
+	assertSockOpt(t, fd, unix.SOL_SOCKET, unix.SO_PRIORITY, 5)
+}
+
+func (s *testSocketOptionsServer) OnBoot(eng Engine) (action Action) {
+	s.eng = eng
+	fd, err := eng.Dup()
+	require.NoError(s.tester, err)
+	defer unix.Close(fd) //nolint:errcheck
+	assertSockOpt(s.tester, fd, unix.IPPROTO_TCP, unix.TCP_FASTOPEN, 16)
+	assertSockOpt(s.tester, fd, unix.SOL_SOCKET, unix.SO_PRIORITY, 5)
+	v, err := unix.GetsockoptInt(fd, unix.IPPROTO_TCP, unix.TCP_DEFER_ACCEPT)
+	require.NoError(s.tester, err)
+	assert.Positive(s.tester, v)
+	return
+}
+
+func (s *testSocketOptionsServer) OnOpen(c Conn) (out []byte, action Action) {
+	atomic.AddInt32(&s.opened, 1)
+	assertConnSockOpts(s.tester, c.Fd())
+	return
+}
+
+func (s *testSocketOptionsServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testSocketOptionsServer) run() {
+	cli, err := NewClient(&BuiltinEventEngine{}, s.options()...)
+	require.NoError(s.tester, err)
+	require.NoError(s.tester, cli.Start())
+	defer cli.Stop() //nolint:errcheck
+	c, err := cli.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close() //nolint:errcheck
+	assertConnSockOpts(s.tester, c.Fd())
+
+	// TCP_DEFER_ACCEPT holds the connection back until the first data arrives.
+	_, err = c.Write([]byte("hello"))
+	require.NoError(s.tester, err)
+	require.Eventually(s.tester, func() bool {
+		return atomic.LoadInt32(&s.opened) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestUnixFDPassing(t *testing.T) {
+	svr := &testUnixFDPassingServer{scenarioServer: scenarioServer{tester: t, addr: "gnet-fds.sock"}}
+	svr.scenario = svr.run
+	err := Run(svr, "unix://"+svr.addr, WithTicker(true))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&svr.received))
+}
+
+type testUnixFDPassingServer struct {
+	scenarioServer
+	received int32
+}
+
+func (s *testUnixFDPassingServer) OnOpen(c Conn) (out []byte, action Action) {
+	cred, err := c.PeerCredentials()
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, os.Getpid(), cred.PID)
+	assert.Equal(s.tester, os.Getuid(), cred.UID)
+	assert.Equal(s.tester, os.Getgid(), cred.GID)
+	return
+}
+
+func (s *testUnixFDPassingServer) OnTraffic(c Conn) (action Action) {
+	fds := c.ReadFDs()
+	if len(fds) == 0 {
+		return
+	}
+	atomic.AddInt32(&s.received, 1)
+	buf, _ := c.Next(-1)
+	assert.Equal(s.tester, "ping", string(buf))
+	assert.Nil(s.tester, c.ReadFDs(), "file descriptors should be taken only once")
+	_, err := c.WriteWithFDs(nil, fds)
+	assert.ErrorIs(s.tester, err, errorx.ErrNoDataWithFDs)
+	// Send the received file descriptor back to the peer.
+	n, err := c.WriteWithFDs([]byte("pong"), fds)
+	assert.NoError(s.tester, err)
+	assert.Equal(s.tester, 4, n)
+	for _, fd := range fds {
+		assert.NoError(s.tester, unix.Close(fd))
+	}
+	return
+}
+
+func (s *testUnixFDPassingServer) run() {
+	r, w, err := os.Pipe()
+	require.NoError(s.tester, err)
+	defer r.Close() //nolint:errcheck
+	defer w.Close() //nolint:errcheck
+
+	c, err := net.Dial("unix", s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close() //nolint:errcheck
+	uc := c.(*net.UnixConn)
+	_, _, err = uc.WriteMsgUnix([]byte("ping"), unix.UnixRights(int(w.Fd())), nil)
+	require.NoError(s.tester, err)
+
+	buf, oob := make([]byte, 5), make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := uc.ReadMsgUnix(buf, oob)
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, "pong", string(buf[:n]))
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	require.NoError(s.tester, err)
+	require.Len(s.tester, msgs, 1)
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	require.NoError(s.tester, err)
+	require.Len(s.tester, fds, 1)
+
+	// The file descriptor travelled back and forth should refer to the write end of the pipe.
+	f := os.NewFile(uintptr(fds[0]), "pipe")
+	defer f.Close() //nolint:errcheck
+	_, err = f.Write([]byte("hello"))
+	require.NoError(s.tester, err)
+	_, err = r.Read(buf[:5])
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, "hello", string(buf[:5]))
+}
+
+func TestUnixSocketKinds(t *testing.T) {
+	t.Run("abstract", func(t *testing.T) {
+		svr := &testUnixSocketKindsServer{scenarioServer: scenarioServer{tester: t, network: "unix", addr: "@gnet-abstract"}}
+		svr.scenario = svr.run
+		err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true))
+		assert.NoError(t, err)
+		_, err = os.Stat(svr.addr)
+		assert.True(t, os.IsNotExist(err), "abstract socket should not be present in the filesystem")
+	})
+	t.Run("unixgram", func(t *testing.T) {
+		svr := &testUnixSocketKindsServer{scenarioServer: scenarioServer{tester: t, network: "unixgram", addr: "gnet-dgram.sock"}}
+		svr.scenario = svr.run
+		err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true), WithMulticore(true))
+		assert.NoError(t, err)
+	})
+	t.Run("unixpacket", func(t *testing.T) {
+		svr := &testUnixSocketKindsServer{scenarioServer: scenarioServer{tester: t, network: "unixpacket", addr: "gnet-packet.sock"}}
+		svr.scenario = svr.run
+		err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true))
+		assert.NoError(t, err)
+	})
+	t.Run("file-perm", func(t *testing.T) {
+		svr := &testUnixSocketKindsServer{scenarioServer: scenarioServer{tester: t, network: "unix", addr: "gnet-perm.sock"}, perm: 0o600}
+		svr.scenario = svr.run
+		err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true),
+			WithUnixSocketPerm(0o600), WithUnixSocketOwner(-1, os.Getgid()))
+		assert.NoError(t, err)
+		_, err = os.Stat(svr.addr)
+		assert.True(t, os.IsNotExist(err), "socket file should be removed after the engine stops")
+	})
+	t.Run("file-perm-only", func(t *testing.T) {
+		// The zero value of ownership leaves it unchanged, which works for non-root users.
+		svr := &testUnixSocketKindsServer{scenarioServer: scenarioServer{tester: t, network: "unix", addr: "gnet-perm-only.sock"}, perm: 0o600}
+		svr.scenario = svr.run
+		err := Run(svr, svr.network+"://"+svr.addr,
+			WithOptions(Options{UnixSocketFile: &UnixSocketFile{Perm: 0o600}}), WithTicker(true))
+		assert.NoError(t, err)
+	})
+}
+
+type testUnixSocketKindsServer struct {
+	scenarioServer
+	perm os.FileMode
+}
+
+func (s *testUnixSocketKindsServer) OnBoot(_ Engine) (action Action) {
+	if s.perm != 0 {
+		fi, err := os.Stat(s.addr)
+		require.NoError(s.tester, err)
+		assert.Equal(s.tester, s.perm, fi.Mode().Perm())
+	}
+	return
+}
+
+func (s *testUnixSocketKindsServer) OnTraffic(c Conn) (action Action) {
+	assert.Equal(s.tester, s.network, c.LocalAddr().Network())
+	// Only echo the first 5 bytes, the rest of message is discarded for message-oriented sockets.
+	buf, _ := c.Next(5)
+	_, err := c.Write(buf)
+	assert.NoError(s.tester, err)
+	return
+}
+
+func (s *testUnixSocketKindsServer) run() {
+	var (
+		c   net.Conn
+		err error
+	)
+	if s.network == "unixgram" {
+		laddr := &net.UnixAddr{Name: "gnet-dgram-client.sock", Net: s.network}
+		c, err = net.DialUnix(s.network, laddr, &net.UnixAddr{Name: s.addr, Net: s.network})
+		defer os.Remove(laddr.Name) //nolint:errcheck
+	} else {
+		c, err = net.Dial(s.network, s.addr)
+	}
+	require.NoError(s.tester, err)
+	defer c.Close() //nolint:errcheck
+
+	msgs := []string{"hello, gnet", "world, gnet"}
+	if s.network == "unix" {
+		// Stream socket doesn't preserve the message boundaries.
+		msgs = msgs[:1]
+	}
+	for _, msg := range msgs {
+		_, err = c.Write([]byte(msg))
+		require.NoError(s.tester, err)
+	}
+	buf := make([]byte, 64)
+	for _, msg := range msgs {
+		require.NoError(s.tester, c.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := c.Read(buf)
+		require.NoError(s.tester, err)
+		assert.Equal(s.tester, msg[:5], string(buf[:n]))
+	}
+}
+
+func TestEdgeTriggered(t *testing.T) {
+	t.Run("drain", func(t *testing.T) {
+		svr := &testEdgeTriggeredServer{scenarioServer: scenarioServer{tester: t, addr: "127.0.0.1:9958"}, closed: make(chan error, 1)}
+		svr.scenario = svr.run
+		// Small budget and send buffer force both the resumed reads and the pending writes.
+		err := Run(svr, "tcp://"+svr.addr, WithTicker(true), WithEdgeTriggered(true),
+			WithReadBufferCap(1024), WithReadBudget(0, 2), WithSocketSendBuffer(4096))
+		assert.NoError(t, err)
+	})
+	t.Run("drain-with-loop-budget", func(t *testing.T) {
+		svr := &testEdgeTriggeredServer{scenarioServer: scenarioServer{tester: t, addr: "127.0.0.1:9957"}, closed: make(chan error, 1)}
+		svr.scenario = svr.run
+		err := Run(svr, "tcp://"+svr.addr, WithTicker(true), WithEdgeTriggered(true),
+			WithLoopTrafficBudget(time.Microsecond))
+		assert.NoError(t, err)
+	})
+}
+
+type testEdgeTriggeredServer struct {
+	scenarioServer
+	closed chan error
+}
+
+func (s *testEdgeTriggeredServer) OnOpen(c Conn) (out []byte, action Action) {
+	assert.True(s.tester, c.(*conn).edgeTriggered)
+	return
+}
+
+func (s *testEdgeTriggeredServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, err := c.Write(buf)
+	assert.NoError(s.tester, err)
+	return
+}
+
+func (s *testEdgeTriggeredServer) OnClose(_ Conn, err error) (action Action) {
+	s.closed <- err
+	return
+}
+
+func (s *testEdgeTriggeredServer) run() {
+	c, err := net.Dial("tcp", s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close() //nolint:errcheck
+
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	go func() {
+		_, _ = c.Write(data)
+	}()
+	require.NoError(s.tester, c.SetReadDeadline(time.Now().Add(10*time.Second)))
+	echo := make([]byte, len(data))
+	_, err = io.ReadFull(c, echo)
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, data, echo)
+
+	// Half-close the connection, which must be detected by EPOLLRDHUP.
+	require.NoError(s.tester, c.(*net.TCPConn).CloseWrite())
+	select {
+	case <-s.closed:
+	case <-time.After(5 * time.Second):
+		assert.Fail(s.tester, "half-closed connection is not detected")
+	}
+}
+
+func BenchmarkEdgeTriggered(b *testing.B) {
+	b.Run("level-triggered", func(b *testing.B) {
+		benchmarkEcho(b, "127.0.0.1:9956", false, 1, 0)
+	})
+	b.Run("edge-triggered", func(b *testing.B) {
+		benchmarkEcho(b, "127.0.0.1:9956", true, 1, 0)
+	})
+	// The responses are larger than the socket send buffer, which keeps the writable event
+	// of each connection being watched and unwatched in level-triggered mode.
+	b.Run("level-triggered-backlog", func(b *testing.B) {
+		benchmarkEcho(b, "127.0.0.1:9956", false, 8, 1024*1024)
+	})
+	b.Run("edge-triggered-backlog", func(b *testing.B) {
+		benchmarkEcho(b, "127.0.0.1:9956", true, 8, 1024*1024)
+	})
+}
+
+const benchmarkRequestSize = 16 * 1024
+
+type benchmarkEchoServer struct {
+	*BuiltinEventEngine
+	booted chan Engine
+	reply  []byte // the response to each request, the request is echoed if it's empty
+}
+
+func (s *benchmarkEchoServer) OnBoot(eng Engine) (action Action) {
+	s.booted <- eng
+	return
+}
+
+func (s *benchmarkEchoServer) OnTraffic(c Conn) (action Action) {
+	if len(s.reply) == 0 {
+		buf, _ := c.Next(-1)
+		_, _ = c.Write(buf)
+		return
+	}
+	for c.InboundBuffered() >= benchmarkRequestSize {
+		_, _ = c.Discard(benchmarkRequestSize)
+		_, _ = c.Write(s.reply)
+	}
+	return
+}
+
+// benchmarkEcho sends requests over the given number of connections concurrently, each request
+// is answered with a response of replySize bytes, or echoed if replySize is 0.
+func benchmarkEcho(b *testing.B, addr string, edgeTriggered bool, conns, replySize int) {
+	svr := &benchmarkEchoServer{booted: make(chan Engine, 1), reply: make([]byte, replySize)}
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(svr, "tcp://"+addr, WithEdgeTriggered(edgeTriggered), WithMulticore(true),
+			WithSocketSendBuffer(64*1024))
+	}()
+	eng := <-svr.booted
+	defer func() {
+		_ = eng.Stop(context.Background())
+		require.NoError(b, <-done)
+	}()
+
+	clients := make([]net.Conn, conns)
+	for i := range clients {
+		var err error
+		// The listener is bound after OnBoot, wait for it.
+		for j := 0; j < 100; j++ {
+			if clients[i], err = net.Dial("tcp", addr); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		require.NoError(b, err)
+		defer clients[i].Close() //nolint:errcheck
+	}
+
+	respSize := replySize
+	if respSize == 0 {
+		respSize = benchmarkRequestSize
+	}
+	b.SetBytes(int64(respSize))
+	b.ResetTimer()
+	var (
+		wg   sync.WaitGroup
+		left = int64(b.N)
+	)
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c net.Conn) {
+			defer wg.Done()
+			msg := make([]byte, benchmarkRequestSize)
+			resp := make([]byte, respSize)
+			for atomic.AddInt64(&left, -1) >= 0 {
+				if _, err := c.Write(msg); err != nil {
+					b.Error(err)
+					return
+				}
+				if _, err := io.ReadFull(c, resp); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	b.StopTimer()
+}
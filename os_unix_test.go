@@ -5,8 +5,10 @@ package gnet
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"sync"
@@ -17,6 +19,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sys/unix"
+
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 )
 
 var (
@@ -515,3 +520,674 @@ func (s *testEngineClosedWakeUpServer) OnClose(Conn, error) (action Action) {
 	return
 }
 */
+
+func TestRegisterFD(t *testing.T) {
+	t.Run("reactors", func(t *testing.T) {
+		testRegisterFD(t, "tcp", ":9982", false)
+	})
+	t.Run("reuseport", func(t *testing.T) {
+		testRegisterFD(t, "tcp", ":9983", true)
+	})
+}
+
+type testRegisterFDServer struct {
+	scenarioServer
+}
+
+func (s *testRegisterFDServer) OnBoot(eng Engine) (action Action) {
+	s.eng = eng
+	_, err := eng.RegisterFD(0, 0, FDEventRead, func(int, FDEvent) {})
+	assert.ErrorIs(s.tester, err, errorx.ErrInvalidLoopIndex, "event-loops are not available in OnBoot")
+	return
+}
+
+func (s *testRegisterFDServer) run() {
+	var p [2]int
+	require.NoError(s.tester, unix.Pipe(p[:]))
+	defer unix.Close(p[0]) //nolint:errcheck
+	defer unix.Close(p[1]) //nolint:errcheck
+	require.NoError(s.tester, unix.SetNonblock(p[0], true))
+	require.NoError(s.tester, unix.SetNonblock(p[1], true))
+
+	fired := make(chan FDEvent, 16)
+	handler := func(fd int, events FDEvent) {
+		if events&FDEventRead != 0 {
+			var buf [16]byte
+			_, _ = unix.Read(fd, buf[:])
+		}
+		select {
+		case fired <- events:
+		default:
+		}
+	}
+	_, err := s.eng.RegisterFD(2, p[0], FDEventRead, handler)
+	assert.ErrorIs(s.tester, err, errorx.ErrInvalidLoopIndex)
+	_, err = s.eng.RegisterFD(1, p[0], 0, handler)
+	assert.ErrorIs(s.tester, err, errorx.ErrInvalidFDEvents)
+
+	rfd, err := s.eng.RegisterFD(1, p[0], FDEventRead, handler)
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, p[0], rfd.Fd())
+	assert.Equal(s.tester, 1, rfd.LoopIndex())
+	_, err = s.eng.RegisterFD(1, p[0], FDEventRead, handler)
+	assert.ErrorIs(s.tester, err, errorx.ErrFDRegistered)
+
+	_, err = unix.Write(p[1], []byte("ping"))
+	require.NoError(s.tester, err)
+	select {
+	case ev := <-fired:
+		assert.Equal(s.tester, FDEventRead, ev&FDEventRead)
+	case <-time.After(5 * time.Second):
+		s.tester.Error("readable event is not fired")
+	}
+
+	// The write end of pipe is always writable.
+	wfd, err := s.eng.RegisterFD(1, p[1], FDEventRead, handler)
+	require.NoError(s.tester, err)
+	require.NoError(s.tester, wfd.Modify(FDEventWrite))
+	select {
+	case ev := <-fired:
+		assert.Equal(s.tester, FDEventWrite, ev&FDEventWrite)
+	case <-time.After(5 * time.Second):
+		s.tester.Error("writable event is not fired")
+	}
+	require.NoError(s.tester, wfd.Unregister())
+	assert.ErrorIs(s.tester, wfd.Unregister(), errorx.ErrFDUnregistered)
+	assert.ErrorIs(s.tester, wfd.Modify(FDEventRead), errorx.ErrFDUnregistered)
+
+	require.NoError(s.tester, rfd.Unregister())
+	time.Sleep(50 * time.Millisecond)
+	for len(fired) > 0 {
+		<-fired
+	}
+	_, err = unix.Write(p[1], []byte("ping"))
+	require.NoError(s.tester, err)
+	select {
+	case ev := <-fired:
+		s.tester.Errorf("unexpected event %d after the fd is unregistered", ev)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func testRegisterFD(t *testing.T, network, addr string, reusePort bool) {
+	svr := &testRegisterFDServer{scenarioServer: scenarioServer{tester: t, async: true}}
+	svr.scenario = svr.run
+	err := Run(svr, network+"://"+addr,
+		WithTicker(true),
+		WithNumEventLoop(2),
+		WithReusePort(reusePort))
+	assert.NoError(t, err)
+}
+
+func TestSocketControl(t *testing.T) {
+	svr := &testSocketControlServer{scenarioServer: scenarioServer{tester: t, network: "tcp", addr: "127.0.0.1:9963"}}
+	svr.scenario = svr.run
+	var listenerControlled int32
+	err := Run(svr, svr.network+"://"+svr.addr,
+		WithTicker(true),
+		WithListenerControl(func(network, address string, fd int) error {
+			atomic.AddInt32(&listenerControlled, 1)
+			assert.Equal(t, svr.network, network)
+			assert.Equal(t, svr.addr, address)
+			// The listener must not be bound yet.
+			sa, err := unix.Getsockname(fd)
+			require.NoError(t, err)
+			assert.Zero(t, sa.(*unix.SockaddrInet4).Port)
+			return unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE, 1)
+		}),
+		WithConnControl(func(network, address string, fd int) error {
+			assert.Equal(t, svr.network, network)
+			assert.NotEmpty(t, address)
+			if atomic.AddInt32(&svr.controlled, 1)%2 == 0 {
+				return errors.New("rejected by ConnControl")
+			}
+			return nil
+		}))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&listenerControlled))
+
+	err = Run(svr, svr.network+"://"+svr.addr,
+		WithListenerControl(func(_, _ string, _ int) error {
+			return errors.New("aborted by ListenerControl")
+		}))
+	assert.EqualError(t, err, "aborted by ListenerControl")
+}
+
+type testSocketControlServer struct {
+	scenarioServer
+	controlled int32
+	opened     int32
+}
+
+func (s *testSocketControlServer) OnBoot(eng Engine) (action Action) {
+	fd, err := eng.Dup()
+	require.NoError(s.tester, err)
+	defer SysClose(fd) //nolint:errcheck
+	v, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_KEEPALIVE)
+	require.NoError(s.tester, err)
+	assert.Equal(s.tester, 1, v)
+	return
+}
+
+func (s *testSocketControlServer) OnOpen(Conn) (out []byte, action Action) {
+	atomic.AddInt32(&s.opened, 1)
+	return
+}
+
+func (s *testSocketControlServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testSocketControlServer) run() {
+	for i := 0; i < 4; i++ {
+		c, err := net.Dial(s.network, s.addr)
+		require.NoError(s.tester, err)
+		_, err = c.Write([]byte("hello"))
+		require.NoError(s.tester, err)
+		_, err = c.Read(make([]byte, 5))
+		if i%2 == 0 {
+			assert.NoError(s.tester, err)
+		} else {
+			assert.Error(s.tester, err, "connection should be closed by ConnControl")
+		}
+		_ = c.Close()
+	}
+	assert.EqualValues(s.tester, 2, atomic.LoadInt32(&s.opened))
+}
+
+func TestReadSizer(t *testing.T) {
+	var rs readSizer
+	rs.record(1) // no-op when it's disabled
+	assert.Zero(t, rs.size())
+
+	rs.init(64 * 1024)
+	assert.Equal(t, 2048, rs.size())
+	rs.record(2048)
+	assert.Equal(t, 32*1024, rs.size(), "read size should grow rapidly after a full read")
+	rs.record(32 * 1024)
+	assert.Equal(t, 64*1024, rs.size(), "read size should not exceed the limit")
+	rs.record(10)
+	assert.Equal(t, 64*1024, rs.size(), "read size should not shrink after one small read")
+	rs.record(10)
+	assert.Equal(t, 32*1024, rs.size(), "read size should shrink after two small reads in a row")
+	for i := 0; i < 100; i++ {
+		rs.record(10)
+	}
+	assert.Equal(t, 64, rs.size(), "read size should not be less than the minimum")
+
+	rs.init(1024)
+	assert.Equal(t, 1024, rs.size(), "initial read size should not exceed the limit")
+}
+
+func TestAdaptiveReadBuffer(t *testing.T) {
+	svr := &testAdaptiveReadBufferServer{scenarioServer: scenarioServer{tester: t, network: "tcp", addr: "127.0.0.1:9961"}}
+	svr.scenario = svr.run
+	err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true), WithAdaptiveReadBuffer(true))
+	assert.NoError(t, err)
+}
+
+type testAdaptiveReadBufferServer struct {
+	scenarioServer
+	readSize    int64
+	maxReadSize int64
+}
+
+func (s *testAdaptiveReadBufferServer) OnTraffic(c Conn) (action Action) {
+	size := int64(c.(*conn).sizer.size())
+	atomic.StoreInt64(&s.readSize, size)
+	if size > atomic.LoadInt64(&s.maxReadSize) {
+		atomic.StoreInt64(&s.maxReadSize, size)
+	}
+	buf, _ := c.Next(-1)
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testAdaptiveReadBufferServer) run() {
+	c, err := net.Dial(s.network, s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close() //nolint:errcheck
+	data := make([]byte, 1024*1024)
+	go func() {
+		_, err := c.Write(data)
+		assert.NoError(s.tester, err)
+	}()
+	_, err = io.ReadFull(c, make([]byte, len(data)))
+	require.NoError(s.tester, err)
+	assert.Greater(s.tester, atomic.LoadInt64(&s.maxReadSize), int64(initialAdaptiveReadSize),
+		"read size should grow with a fast sender")
+
+	buf := make([]byte, 10)
+	for i := 0; i < 20; i++ {
+		_, err = c.Write(buf)
+		require.NoError(s.tester, err)
+		_, err = io.ReadFull(c, buf)
+		require.NoError(s.tester, err)
+	}
+	assert.Less(s.tester, atomic.LoadInt64(&s.readSize), int64(initialAdaptiveReadSize),
+		"read size should shrink with a slow sender")
+}
+
+func TestReadBudget(t *testing.T) {
+	t.Run("per-connection", func(t *testing.T) {
+		svr := &testReadBudgetServer{scenarioServer: scenarioServer{tester: t, network: "tcp", addr: "127.0.0.1:9960"}, clients: 1, maxBytes: 4096}
+		svr.scenario = svr.run
+		err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true), WithReadBudget(4096, 2))
+		assert.NoError(t, err)
+	})
+	t.Run("per-loop", func(t *testing.T) {
+		svr := &testReadBudgetServer{scenarioServer: scenarioServer{tester: t, network: "tcp", addr: "127.0.0.1:9959"}, clients: 4, slow: true}
+		svr.scenario = svr.run
+		err := Run(svr, svr.network+"://"+svr.addr, WithTicker(true), WithLoopTrafficBudget(time.Millisecond))
+		assert.NoError(t, err)
+	})
+}
+
+type testReadBudgetServer struct {
+	scenarioServer
+	clients   int
+	maxBytes  int
+	slow      bool
+	iteration uint64
+}
+
+func (s *testReadBudgetServer) OnTraffic(c Conn) (action Action) {
+	if s.slow {
+		it := c.(*conn).loop.poller.Iteration()
+		assert.NotEqual(s.tester, s.iteration, it, "only one connection should be served per round of polling")
+		s.iteration = it
+		time.Sleep(2 * time.Millisecond)
+	}
+	buf, _ := c.Next(-1)
+	if s.maxBytes > 0 {
+		assert.LessOrEqual(s.tester, len(buf), s.maxBytes)
+	}
+	_, _ = c.Write(buf)
+	return
+}
+
+func (s *testReadBudgetServer) run() {
+	var wg sync.WaitGroup
+	for i := 0; i < s.clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := net.Dial(s.network, s.addr)
+			require.NoError(s.tester, err)
+			defer c.Close() //nolint:errcheck
+			data := make([]byte, 256*1024)
+			_, _ = rand.Read(data)
+			go func() {
+				_, err := c.Write(data)
+				assert.NoError(s.tester, err)
+			}()
+			buf := make([]byte, len(data))
+			_, err = io.ReadFull(c, buf)
+			require.NoError(s.tester, err)
+			assert.Equal(s.tester, data, buf)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCloseReasons(t *testing.T) {
+	svr := &testCloseReasonsServer{scenarioServer: scenarioServer{tester: t, addr: "127.0.0.1:9955"}, closed: make(chan error, 1)}
+	svr.scenario = svr.run
+	// The connections closed by server leave the address in TIME_WAIT.
+	err := Run(svr, "tcp://"+svr.addr, WithTicker(true), WithReuseAddr(true))
+	assert.NoError(t, err)
+	select {
+	case err = <-svr.closed:
+		assert.ErrorIs(t, err, errorx.ErrEngineShutdown)
+	case <-time.After(time.Second):
+		assert.Fail(t, "connection is not closed on engine shutdown")
+	}
+}
+
+type testCloseReasonsServer struct {
+	scenarioServer
+	closed chan error
+}
+
+func (s *testCloseReasonsServer) OnTraffic(c Conn) (action Action) {
+	buf, _ := c.Next(-1)
+	switch string(buf) {
+	case "close":
+		assert.NoError(s.tester, c.Close())
+	case "action":
+		action = Close
+	}
+	return
+}
+
+func (s *testCloseReasonsServer) OnClose(_ Conn, err error) (action Action) {
+	s.closed <- err
+	return
+}
+
+func (s *testCloseReasonsServer) run() {
+	cases := []struct {
+		reason error
+		cause  error
+		act    func(c *net.TCPConn) error
+	}{
+		{errorx.ErrPeerClosed, io.EOF, func(c *net.TCPConn) error { return c.Close() }},
+		{errorx.ErrPeerClosed, io.EOF, func(c *net.TCPConn) error {
+			// The peer shutdown is detected right after the data are read.
+			if _, err := c.Write([]byte("half-close")); err != nil {
+				return err
+			}
+			return c.CloseWrite()
+		}},
+		{errorx.ErrPeerReset, unix.ECONNRESET, func(c *net.TCPConn) error {
+			// Discard the unsent data and send RST on close.
+			if err := c.SetLinger(0); err != nil {
+				return err
+			}
+			return c.Close()
+		}},
+		{errorx.ErrLocalClosed, nil, func(c *net.TCPConn) error {
+			_, err := c.Write([]byte("close"))
+			return err
+		}},
+		{errorx.ErrHandlerClosed, nil, func(c *net.TCPConn) error {
+			_, err := c.Write([]byte("action"))
+			return err
+		}},
+	}
+	for _, tc := range cases {
+		c, err := net.Dial("tcp", s.addr)
+		require.NoError(s.tester, err)
+		assert.NoError(s.tester, tc.act(c.(*net.TCPConn)))
+		select {
+		case err = <-s.closed:
+			assert.ErrorIs(s.tester, err, tc.reason)
+			if tc.cause != nil {
+				assert.ErrorIs(s.tester, err, tc.cause)
+			}
+		case <-time.After(time.Second):
+			assert.Failf(s.tester, "connection is not closed", "expected reason: %v", tc.reason)
+		}
+		_ = c.Close()
+	}
+
+	// Leave a connection open to be closed by the engine shutdown.
+	c, err := net.Dial("tcp", s.addr)
+	require.NoError(s.tester, err)
+	s.tester.Cleanup(func() { _ = c.Close() })
+}
+
+func TestMemoryLimit(t *testing.T) {
+	t.Run("pause-reads", func(t *testing.T) {
+		testMemoryLimit(t, "127.0.0.1:9954", MemoryLimitPauseReads)
+	})
+	t.Run("pause-reads-edge-triggered", func(t *testing.T) {
+		testMemoryLimit(t, "127.0.0.1:9949", MemoryLimitPauseReads, WithEdgeTriggered(true))
+	})
+	t.Run("reject-async-writes", func(t *testing.T) {
+		testMemoryLimit(t, "127.0.0.1:9953", MemoryLimitRejectAsyncWrites)
+	})
+	t.Run("close-largest", func(t *testing.T) {
+		testMemoryLimit(t, "127.0.0.1:9952", MemoryLimitCloseLargest)
+	})
+}
+
+const (
+	memoryLimit     = 64 * 1024
+	memoryLimitData = 1024 * 1024
+)
+
+func testMemoryLimit(t *testing.T, addr string, policy MemoryLimitPolicy, opts ...Option) {
+	svr := &testMemoryLimitServer{
+		scenarioServer: scenarioServer{tester: t, addr: addr},
+		policy:         policy,
+		opened:         make(chan Conn, 2),
+		closed:         make(chan error, 2),
+	}
+	svr.scenario = svr.run
+	opts = append(opts, WithTicker(true), WithReadBufferCap(4096), WithMemoryLimit(memoryLimit, policy))
+	err := Run(svr, "tcp://"+addr, opts...)
+	assert.NoError(t, err)
+}
+
+type testMemoryLimitServer struct {
+	scenarioServer
+	policy   MemoryLimitPolicy
+	opened   chan Conn
+	closed   chan error
+	consume  int32
+	received int64
+}
+
+func (s *testMemoryLimitServer) OnOpen(c Conn) (out []byte, action Action) {
+	s.opened <- c
+	return
+}
+
+func (s *testMemoryLimitServer) OnClose(_ Conn, err error) (action Action) {
+	s.closed <- err
+	return
+}
+
+func (s *testMemoryLimitServer) OnTraffic(c Conn) (action Action) {
+	// Hold the data in the inbound buffer until it's allowed to consume.
+	if atomic.LoadInt32(&s.consume) == 1 {
+		n, _ := c.Discard(-1)
+		atomic.AddInt64(&s.received, int64(n))
+	}
+	return
+}
+
+// waitForStats waits until the stats of engine satisfy cond.
+func (s *testMemoryLimitServer) waitForStats(cond func(Stats) bool) (stats Stats) {
+	for i := 0; i < 100; i++ {
+		var err error
+		stats, err = s.eng.Stats()
+		assert.NoError(s.tester, err)
+		if cond(stats) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Failf(s.tester, "unexpected stats", "%+v", stats)
+	return
+}
+
+func (s *testMemoryLimitServer) run() {
+	c, err := net.Dial("tcp", s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close() //nolint:errcheck
+	sc := <-s.opened
+	go func() {
+		// Keep the data arriving while the connection is paused, which raises new readable
+		// edges in edge-triggered mode.
+		buf := make([]byte, 4096)
+		for i := 0; i < memoryLimitData; i += len(buf) {
+			if _, err := c.Write(buf); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if s.policy != MemoryLimitCloseLargest {
+		stats := s.waitForStats(func(stats Stats) bool { return stats.MemoryUsage() > memoryLimit })
+		assert.EqualValues(s.tester, memoryLimit, stats.MemoryLimit)
+		assert.EqualValues(s.tester, 1, stats.Connections)
+	}
+
+	switch s.policy {
+	case MemoryLimitPauseReads:
+		// The connection stops being read right after the limit is exceeded.
+		time.Sleep(100 * time.Millisecond)
+		stats := s.waitForStats(func(Stats) bool { return true })
+		assert.LessOrEqual(s.tester, stats.InboundBytes, int64(memoryLimit+4096))
+
+		// Consuming the inbound data resumes reading.
+		atomic.StoreInt32(&s.consume, 1)
+		s.waitForStats(func(Stats) bool { return atomic.LoadInt64(&s.received) == memoryLimitData })
+	case MemoryLimitRejectAsyncWrites:
+		assert.ErrorIs(s.tester, sc.AsyncWrite([]byte("rejected"), nil), errorx.ErrMemoryLimitExceeded)
+	case MemoryLimitCloseLargest:
+		select {
+		case err = <-s.closed:
+			assert.ErrorIs(s.tester, err, errorx.ErrMemoryLimitExceeded)
+		case <-time.After(time.Second):
+			assert.Fail(s.tester, "the largest connection is not closed")
+		}
+		s.waitForStats(func(stats Stats) bool { return stats.Connections == 0 && stats.MemoryUsage() == 0 })
+	}
+}
+
+func TestBufferAllocator(t *testing.T) {
+	slab := allocator.NewSlab(0, 0, 0)
+	svr := &testBufferAllocatorServer{scenarioServer: scenarioServer{tester: t, addr: "127.0.0.1:9951"}}
+	svr.scenario = svr.run
+	err := Run(svr, "tcp://"+svr.addr, WithTicker(true), WithNumEventLoop(2), WithReuseAddr(true),
+		WithSocketSendBuffer(4096), WithBufferAllocator(slab))
+	assert.NoError(t, err)
+	// The buffers of connections have all been freed and the caches of event-loops flushed.
+	assert.NotZero(t, slab.Stats().Reserved)
+	assert.Zero(t, slab.Stats().InUse)
+	assert.Nil(t, slab.Leaks())
+}
+
+const bufferAllocatorFrame = 4096
+
+type testBufferAllocatorServer struct {
+	scenarioServer
+}
+
+func (s *testBufferAllocatorServer) OnTraffic(c Conn) (action Action) {
+	// Leave the incomplete frames in the inbound buffer.
+	for c.InboundBuffered() >= bufferAllocatorFrame {
+		buf, _ := c.Next(bufferAllocatorFrame)
+		_, err := c.Write(buf)
+		assert.NoError(s.tester, err)
+	}
+	return
+}
+
+func (s *testBufferAllocatorServer) run() {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := net.Dial("tcp", s.addr)
+			if !assert.NoError(s.tester, err) {
+				return
+			}
+			defer c.Close()
+			data := make([]byte, 64*bufferAllocatorFrame)
+			rand.Read(data)
+			go func() {
+				// Write the data in pieces that don't align with the frames.
+				for b := data; len(b) > 0; {
+					n := 1000
+					if n > len(b) {
+						n = len(b)
+					}
+					if _, err := c.Write(b[:n]); err != nil {
+						return
+					}
+					b = b[n:]
+				}
+			}()
+			buf := make([]byte, len(data))
+			_, err = io.ReadFull(c, buf)
+			assert.NoError(s.tester, err)
+			assert.Equal(s.tester, data, buf)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestVectoredRead(t *testing.T) {
+	svr := &testVectoredReadServer{scenarioServer: scenarioServer{tester: t, addr: "127.0.0.1:9950"}}
+	svr.scenario = svr.run
+	// The slab reuses the memory freed last first, which would overwrite the segments
+	// being echoed if the inbound buffer was released before OnTraffic returns.
+	err := Run(svr, "tcp://"+svr.addr, WithTicker(true), WithReuseAddr(true), WithReadBufferCap(4096),
+		WithSocketSendBuffer(4096), WithBufferAllocator(allocator.NewSlab(0, 0, 0)))
+	assert.NoError(t, err)
+	// Some frames must have spanned the inbound buffer and the read buffer.
+	assert.True(t, svr.spanned)
+}
+
+type testVectoredReadServer struct {
+	scenarioServer
+	spanned bool
+}
+
+// OnTraffic echoes the length-prefixed frames back with the segments of them.
+func (s *testVectoredReadServer) OnTraffic(c Conn) (action Action) {
+	for {
+		bs, err := c.PeekV(4)
+		if err != nil {
+			return
+		}
+		var header []byte
+		for _, b := range bs {
+			header = append(header, b...)
+		}
+		size := int(binary.BigEndian.Uint32(header))
+		if c.InboundBuffered() < 4+size {
+			return
+		}
+		_, _ = c.Discard(4)
+		bs, err = c.NextV(size)
+		if !assert.NoError(s.tester, err) {
+			return Close
+		}
+		n := 0
+		for _, b := range bs {
+			n += len(b)
+		}
+		if !assert.Equal(s.tester, size, n) {
+			return Close
+		}
+		if len(bs) > 1 {
+			s.spanned = true
+		}
+		// Write the segments back before they're released.
+		if _, err = c.Writev(bs); !assert.NoError(s.tester, err) {
+			return Close
+		}
+	}
+}
+
+func (s *testVectoredReadServer) run() {
+	c, err := net.Dial("tcp", s.addr)
+	require.NoError(s.tester, err)
+	defer c.Close()
+
+	var expected []byte
+	stream := make([]byte, 0, 1024*1024)
+	for i := 0; i < 64; i++ {
+		frame := make([]byte, 4+rand.Intn(32*1024))
+		rand.Read(frame[4:])
+		binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+		stream = append(stream, frame...)
+		expected = append(expected, frame[4:]...)
+	}
+	go func() {
+		// Write the stream in pieces that don't align with the frames.
+		for b := stream; len(b) > 0; {
+			n := 1 + rand.Intn(8192)
+			if n > len(b) {
+				n = len(b)
+			}
+			if _, err := c.Write(b[:n]); err != nil {
+				return
+			}
+			b = b[n:]
+		}
+	}()
+	buf := make([]byte, len(expected))
+	_, err = io.ReadFull(c, buf)
+	assert.NoError(s.tester, err)
+	assert.Equal(s.tester, expected, buf)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package allocator provides the pluggable allocators of the byte slices backing the buffers
+// in gnet, such as ring.Buffer, linkedlist.Buffer and elastic.Buffer.
+package allocator
+
+import bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
+
+// BufferAllocator allocates and frees the byte slices backing buffers.
+type BufferAllocator interface {
+	// Alloc returns a byte slice of the given length, its capacity may be larger than size.
+	Alloc(size int) []byte
+
+	// Free gives the byte slice returned by Alloc back to the allocator, buf may be resliced
+	// to a different length but must start at the same position and keep its capacity.
+	// buf must not be used after Free.
+	Free(buf []byte)
+}
+
+// Cache is a BufferAllocator that serves one goroutine at a time without locking,
+// it borrows byte slices from its parent allocator in batches.
+type Cache interface {
+	BufferAllocator
+
+	// Flush gives all byte slices held by the cache back to its parent allocator.
+	Flush()
+}
+
+// CachingAllocator is implemented by the BufferAllocator that provides caches,
+// gnet creates a Cache for each event-loop from it.
+type CachingAllocator interface {
+	BufferAllocator
+
+	// NewCache returns a new Cache of this allocator.
+	NewCache() Cache
+}
+
+// Default is the allocator backed by the built-in byteslice pool, it's used when no
+// allocator is specified.
+var Default BufferAllocator = pool{}
+
+type pool struct{}
+
+func (pool) Alloc(size int) []byte { return bsPool.Get(size) }
+
+func (pool) Free(buf []byte) { bsPool.Put(buf) }
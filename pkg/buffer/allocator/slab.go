@@ -0,0 +1,351 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package allocator
+
+import (
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/panjf2000/gnet/v2/internal/leakcheck"
+	"github.com/panjf2000/gnet/v2/internal/math"
+)
+
+const (
+	defaultMinSize  = 64
+	defaultMaxSize  = 64 * 1024
+	defaultSlabSize = 1024 * 1024
+	maxCacheBatch   = 32
+)
+
+// Slab is a BufferAllocator that carves byte slices of power-of-two size classes out of
+// large slabs, the byte slices being freed are kept on the free list of their size class
+// for reuse instead of being handed over to the GC, so the memory reserved by Slab never
+// shrinks. The free lists store the positions of byte slices rather than pointers, which
+// keeps the GC from scanning them no matter how many byte slices there are.
+//
+// Byte slices larger than the maximum size class are allocated from the heap directly and
+// left to the GC when they're freed.
+//
+// When gnet is built with the gnet_leakcheck tag, Slab records the allocation stack of every
+// byte slice, which is reported by Slab.Leaks and gnet.BufferLeaks, and panics on freeing a byte
+// slice that is not allocated by it or has been freed already. Every Slab is kept alive for the
+// report in that case.
+type Slab struct {
+	inUse    int64 // bytes of byte slices in use, accessed atomically
+	reserved int64 // bytes of slabs, accessed atomically
+	minShift int
+	classes  []*sizeClass
+	leaks    leakcheck.Tracker
+}
+
+// chunk locates a byte slice in a size class: the index of slab in the high 32 bits and
+// the index of byte slice in that slab in the low 32 bits.
+type chunk uint64
+
+type slabSet struct {
+	mem    [][]byte // slabs in the order of creation
+	sorted []int    // indices of mem sorted by the addresses of slabs
+}
+
+type sizeClass struct {
+	idx     int
+	size    int
+	perSlab int
+	batch   int          // number of byte slices moved between the class and caches at a time
+	slabs   atomic.Value // *slabSet, copied on write
+	mu      sync.Mutex   // protects free
+	free    []chunk
+}
+
+// SlabStats is the statistics of Slab.
+type SlabStats struct {
+	Reserved int64 // bytes of slabs allocated from the heap
+	InUse    int64 // bytes of byte slices allocated from slabs and not freed yet
+}
+
+// Leak describes a byte slice that was allocated from Slab and hasn't been freed.
+type Leak struct {
+	Size  int    // size class of the byte slice
+	Stack string // stack trace of the allocation
+}
+
+// NewSlab returns a Slab with the power-of-two size classes from minSize to maxSize,
+// each slab holds slabSize bytes or a single byte slice of its class, whichever is larger.
+// A non-positive value falls back to the default: 64B, 64KB and 1MB respectively.
+func NewSlab(minSize, maxSize, slabSize int) *Slab {
+	if minSize <= 0 {
+		minSize = defaultMinSize
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxSize < minSize {
+		maxSize = minSize
+	}
+	if slabSize <= 0 {
+		slabSize = defaultSlabSize
+	}
+	minSize, maxSize = math.CeilToPowerOfTwo(minSize), math.CeilToPowerOfTwo(maxSize)
+
+	s := &Slab{minShift: bits.TrailingZeros(uint(minSize))}
+	s.leaks.Kind = "slab"
+	leakcheck.Register(&s.leaks)
+	for size := minSize; size <= maxSize; size <<= 1 {
+		sc := &sizeClass{idx: len(s.classes), size: size, perSlab: 1}
+		if slabSize > size {
+			sc.perSlab = slabSize / size
+		}
+		sc.batch = sc.perSlab / 4
+		if sc.batch < 1 {
+			sc.batch = 1
+		} else if sc.batch > maxCacheBatch {
+			sc.batch = maxCacheBatch
+		}
+		sc.slabs.Store(&slabSet{})
+		s.classes = append(s.classes, sc)
+	}
+	return s
+}
+
+// Alloc implements BufferAllocator.
+func (s *Slab) Alloc(size int) []byte {
+	if size <= 0 {
+		return nil
+	}
+	sc := s.classFor(size)
+	if sc == nil {
+		return make([]byte, size)
+	}
+	sc.mu.Lock()
+	if len(sc.free) == 0 {
+		s.grow(sc)
+	}
+	n := len(sc.free) - 1
+	ch := sc.free[n]
+	sc.free = sc.free[:n]
+	sc.mu.Unlock()
+	return s.hand(sc, ch, size)
+}
+
+// Free implements BufferAllocator.
+func (s *Slab) Free(buf []byte) {
+	sc, ch, ok := s.reclaim(buf)
+	if !ok {
+		return
+	}
+	sc.mu.Lock()
+	sc.free = append(sc.free, ch)
+	sc.mu.Unlock()
+}
+
+// NewCache implements CachingAllocator.
+func (s *Slab) NewCache() Cache {
+	return &SlabCache{slab: s, free: make([][]chunk, len(s.classes))}
+}
+
+// Stats returns the statistics of Slab.
+func (s *Slab) Stats() SlabStats {
+	return SlabStats{
+		Reserved: atomic.LoadInt64(&s.reserved),
+		InUse:    atomic.LoadInt64(&s.inUse),
+	}
+}
+
+// Leaks returns the byte slices that have not been freed along with their allocation stacks,
+// it always returns nil unless gnet is built with the gnet_leakcheck tag.
+func (s *Slab) Leaks() []Leak {
+	records := s.leaks.Records()
+	if len(records) == 0 {
+		return nil
+	}
+	leaks := make([]Leak, len(records))
+	for i, r := range records {
+		leaks[i] = Leak{r.Size, r.Stack}
+	}
+	return leaks
+}
+
+// classFor returns the smallest size class that fits size, or nil if size exceeds the maximum.
+func (s *Slab) classFor(size int) *sizeClass {
+	idx := bits.Len(uint(size-1)) - s.minShift
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(s.classes) {
+		return nil
+	}
+	return s.classes[idx]
+}
+
+// grow allocates a new slab for sc and puts all byte slices in it onto the free list,
+// it must be called with sc.mu held.
+func (s *Slab) grow(sc *sizeClass) {
+	mem := make([]byte, sc.size*sc.perSlab)
+	old := sc.slabs.Load().(*slabSet)
+	set := &slabSet{
+		mem:    append(old.mem[:len(old.mem):len(old.mem)], mem),
+		sorted: make([]int, 0, len(old.sorted)+1),
+	}
+	idx, base := len(old.mem), addressOf(mem)
+	i := sort.Search(len(old.sorted), func(i int) bool { return addressOf(old.mem[old.sorted[i]]) > base })
+	set.sorted = append(set.sorted, old.sorted[:i]...)
+	set.sorted = append(set.sorted, idx)
+	set.sorted = append(set.sorted, old.sorted[i:]...)
+	sc.slabs.Store(set)
+
+	// Push the byte slices in reverse so that they're handed out from the start of slab.
+	for j := sc.perSlab - 1; j >= 0; j-- {
+		sc.free = append(sc.free, chunk(idx)<<32|chunk(j))
+	}
+	atomic.AddInt64(&s.reserved, int64(len(mem)))
+}
+
+// take moves up to n byte slices from the free list of sc to dst.
+func (s *Slab) take(sc *sizeClass, dst []chunk, n int) []chunk {
+	sc.mu.Lock()
+	if len(sc.free) == 0 {
+		s.grow(sc)
+	}
+	if n > len(sc.free) {
+		n = len(sc.free)
+	}
+	m := len(sc.free) - n
+	dst = append(dst, sc.free[m:]...)
+	sc.free = sc.free[:m]
+	sc.mu.Unlock()
+	return dst
+}
+
+// put moves the byte slices back to the free list of sc.
+func (s *Slab) put(sc *sizeClass, chunks []chunk) {
+	sc.mu.Lock()
+	sc.free = append(sc.free, chunks...)
+	sc.mu.Unlock()
+}
+
+// hand returns the byte slice located by ch with the given length.
+func (s *Slab) hand(sc *sizeClass, ch chunk, size int) []byte {
+	buf := sc.bytes(ch)
+	atomic.AddInt64(&s.inUse, int64(sc.size))
+	if leakcheck.Enabled {
+		s.leaks.Track(addressOf(buf), sc.size, 2)
+	}
+	return buf[:size]
+}
+
+// reclaim locates buf in the slabs, ok is false if buf is not allocated from them.
+func (s *Slab) reclaim(buf []byte) (sc *sizeClass, ch chunk, ok bool) {
+	size := cap(buf)
+	if size == 0 {
+		return
+	}
+	if sc = s.classFor(size); sc != nil {
+		ch, ok = sc.chunkOf(buf)
+	}
+	if !ok {
+		if leakcheck.Enabled && size <= s.classes[len(s.classes)-1].size {
+			panic("allocator: freeing a byte slice that is not allocated by Slab")
+		}
+		return
+	}
+	if !s.leaks.Untrack(addressOf(buf)) {
+		panic("allocator: freeing a byte slice that has been freed")
+	}
+	atomic.AddInt64(&s.inUse, -int64(sc.size))
+	return
+}
+
+func (sc *sizeClass) bytes(ch chunk) []byte {
+	set := sc.slabs.Load().(*slabSet)
+	off := int(uint32(ch)) * sc.size
+	return set.mem[ch>>32][off : off+sc.size : off+sc.size]
+}
+
+// chunkOf locates buf in the slabs of sc.
+func (sc *sizeClass) chunkOf(buf []byte) (chunk, bool) {
+	if cap(buf) != sc.size {
+		return 0, false
+	}
+	p := addressOf(buf)
+	set := sc.slabs.Load().(*slabSet)
+	i := sort.Search(len(set.sorted), func(i int) bool { return addressOf(set.mem[set.sorted[i]]) > p }) - 1
+	if i < 0 {
+		return 0, false
+	}
+	idx := set.sorted[i]
+	off := p - addressOf(set.mem[idx])
+	if off >= uintptr(len(set.mem[idx])) || off%uintptr(sc.size) != 0 {
+		return 0, false
+	}
+	return chunk(idx)<<32 | chunk(off/uintptr(sc.size)), true
+}
+
+func addressOf(buf []byte) uintptr {
+	return uintptr(unsafe.Pointer(&buf[:1][0]))
+}
+
+// SlabCache is the Cache of Slab, it must not be used by multiple goroutines concurrently,
+// but a byte slice allocated from one SlabCache may be freed to another SlabCache or the
+// Slab itself.
+type SlabCache struct {
+	slab *Slab
+	free [][]chunk // free lists of size classes
+}
+
+// Alloc implements BufferAllocator.
+func (c *SlabCache) Alloc(size int) []byte {
+	if size <= 0 {
+		return nil
+	}
+	sc := c.slab.classFor(size)
+	if sc == nil {
+		return make([]byte, size)
+	}
+	free := c.free[sc.idx]
+	if len(free) == 0 {
+		free = c.slab.take(sc, free, sc.batch)
+	}
+	n := len(free) - 1
+	ch := free[n]
+	c.free[sc.idx] = free[:n]
+	return c.slab.hand(sc, ch, size)
+}
+
+// Free implements BufferAllocator.
+func (c *SlabCache) Free(buf []byte) {
+	sc, ch, ok := c.slab.reclaim(buf)
+	if !ok {
+		return
+	}
+	free := append(c.free[sc.idx], ch)
+	if len(free) > 2*sc.batch {
+		c.slab.put(sc, free[sc.batch:])
+		free = free[:sc.batch]
+	}
+	c.free[sc.idx] = free
+}
+
+// Flush implements Cache.
+func (c *SlabCache) Flush() {
+	for i, free := range c.free {
+		if len(free) > 0 {
+			c.slab.put(c.slab.classes[i], free)
+			c.free[i] = free[:0]
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package allocator
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2/internal/leakcheck"
+)
+
+func TestSlab(t *testing.T) {
+	s := NewSlab(64, 1024, 4096)
+
+	assert.Nil(t, s.Alloc(0))
+	buf := s.Alloc(1)
+	assert.Len(t, buf, 1)
+	assert.Equal(t, 64, cap(buf))
+	buf2 := s.Alloc(100)
+	assert.Len(t, buf2, 100)
+	assert.Equal(t, 128, cap(buf2))
+	assert.EqualValues(t, SlabStats{Reserved: 2 * 4096, InUse: 64 + 128}, s.Stats())
+
+	// The freed byte slice is handed out again.
+	s.Free(buf[:0])
+	buf3 := s.Alloc(64)
+	assert.Equal(t, addressOf(buf), addressOf(buf3))
+	s.Free(buf3)
+	s.Free(buf2)
+	assert.EqualValues(t, SlabStats{Reserved: 2 * 4096}, s.Stats())
+
+	// Byte slices larger than the maximum size class come from the heap.
+	big := s.Alloc(1025)
+	assert.Len(t, big, 1025)
+	s.Free(big)
+	assert.EqualValues(t, SlabStats{Reserved: 2 * 4096}, s.Stats())
+
+	// Slabs are added as needed and the byte slices never overlap.
+	seen := make(map[uintptr]bool)
+	var bufs [][]byte
+	for i := 0; i < 3*4096/512; i++ {
+		b := s.Alloc(512)
+		require.False(t, seen[addressOf(b)])
+		seen[addressOf(b)] = true
+		bufs = append(bufs, b)
+	}
+	assert.EqualValues(t, 5*4096, s.Stats().Reserved)
+	for _, b := range bufs {
+		s.Free(b)
+	}
+	assert.Zero(t, s.Stats().InUse)
+}
+
+func TestSlabFreeForeign(t *testing.T) {
+	s := NewSlab(0, 0, 0)
+	buf := s.Alloc(128)
+	defer s.Free(buf)
+
+	foreign := [][]byte{make([]byte, 128), buf[64:], buf[:64:64]}
+	for _, b := range foreign {
+		if leakcheck.Enabled {
+			assert.Panics(t, func() { s.Free(b) })
+		} else {
+			assert.NotPanics(t, func() { s.Free(b) })
+		}
+	}
+	assert.EqualValues(t, 128, s.Stats().InUse)
+}
+
+func TestSlabCache(t *testing.T) {
+	s := NewSlab(64, 64*1024, 64*1024)
+	c := s.NewCache()
+
+	var bufs [][]byte
+	for i := 0; i < 100; i++ {
+		bufs = append(bufs, c.Alloc(1000))
+	}
+	assert.EqualValues(t, 100*1024, s.Stats().InUse)
+	// Byte slices can be freed to the slab or another cache.
+	for i, b := range bufs {
+		switch i % 3 {
+		case 0:
+			c.Free(b)
+		case 1:
+			s.Free(b)
+		default:
+			s.NewCache().Free(b)
+		}
+	}
+	assert.Zero(t, s.Stats().InUse)
+	reserved := s.Stats().Reserved
+
+	c.Flush()
+	for i := 0; i < 100; i++ {
+		c.Free(s.Alloc(1000))
+	}
+	assert.EqualValues(t, SlabStats{Reserved: reserved}, s.Stats())
+}
+
+func TestSlabConcurrentCaches(t *testing.T) {
+	s := NewSlab(0, 0, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			c := s.NewCache()
+			defer c.Flush()
+			var bufs [][]byte
+			for j := 0; j < 1000; j++ {
+				b := c.Alloc(64 << (j % 8))
+				for k := range b {
+					b[k] = id
+				}
+				bufs = append(bufs, b)
+				if j%3 == 0 {
+					b, bufs = bufs[0], bufs[1:]
+					assert.Equal(t, len(b), bytes.Count(b, []byte{id}))
+					c.Free(b)
+				}
+			}
+			for _, b := range bufs {
+				c.Free(b)
+			}
+		}(byte(i))
+	}
+	wg.Wait()
+	assert.Zero(t, s.Stats().InUse)
+}
+
+func TestSlabLeaks(t *testing.T) {
+	s := NewSlab(0, 0, 0)
+	buf := s.Alloc(100)
+	leaks := s.Leaks()
+	if !leakcheck.Enabled {
+		assert.Nil(t, leaks)
+		return
+	}
+	require.Len(t, leaks, 1)
+	assert.Equal(t, 128, leaks[0].Size)
+	assert.Contains(t, leaks[0].Stack, "allocator.TestSlabLeaks")
+	assert.NotContains(t, leaks[0].Stack, "allocator.(*Slab).Alloc")
+
+	s.Free(buf)
+	assert.Nil(t, s.Leaks())
+	assert.Panics(t, func() { s.Free(buf) })
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 )
 
 func TestMixedBuffer_Basic(t *testing.T) {
@@ -179,3 +181,46 @@ func TestMixedBuffer_WriteTo(t *testing.T) {
 	require.NotNil(t, mb.ringBuffer)
 	require.True(t, mb.IsEmpty())
 }
+
+func TestMixedBuffer_WithAllocator(t *testing.T) {
+	slab := allocator.NewSlab(0, 0, 0)
+	const maxStaticSize = 4 * 1024
+	mb, _ := New(maxStaticSize)
+	mb.SetAllocator(slab)
+
+	data := make([]byte, 2*maxStaticSize)
+	rand.Read(data)
+	for i := 0; i < 2; i++ {
+		n, err := mb.Write(data)
+		require.NoError(t, err)
+		require.EqualValues(t, len(data), n)
+	}
+	require.False(t, mb.listBuffer.IsEmpty())
+	require.NotZero(t, slab.Stats().InUse)
+
+	w := bytes.NewBuffer(nil)
+	m, err := mb.WriteTo(w)
+	require.NoError(t, err)
+	require.EqualValues(t, 2*len(data), m)
+	require.EqualValues(t, append(data, data...), w.Bytes())
+	// The memory is given back to the allocator as soon as the buffer is drained.
+	require.True(t, mb.IsEmpty())
+	require.Zero(t, slab.Stats().InUse)
+
+	_, _ = mb.Writev([][]byte{data[:100], data[100 : maxStaticSize+100]})
+	require.NotZero(t, slab.Stats().InUse)
+	mb.Release()
+	require.Zero(t, slab.Stats().InUse)
+
+	var rb RingBuffer
+	rb.SetAllocator(slab)
+	_, _ = rb.Write(data[:100])
+	require.EqualValues(t, 1024, slab.Stats().InUse)
+	buf := make([]byte, 100)
+	_, _ = rb.Read(buf)
+	require.EqualValues(t, data[:100], buf)
+	require.Zero(t, slab.Stats().InUse)
+	_, _ = rb.Write(data[:100])
+	rb.Done()
+	require.Zero(t, slab.Stats().InUse)
+}
@@ -17,18 +17,34 @@ package elastic
 import (
 	"io"
 
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 	"github.com/panjf2000/gnet/v2/pkg/buffer/ring"
 	rbPool "github.com/panjf2000/gnet/v2/pkg/pool/ringbuffer"
 )
 
 // RingBuffer is the elastic wrapper of ring.Buffer.
 type RingBuffer struct {
-	rb *ring.Buffer
+	rb    *ring.Buffer
+	spare *ring.Buffer // released ring-buffer kept for reuse when alloc is set
+	alloc allocator.BufferAllocator
+}
+
+// SetAllocator makes the internal ring-buffer allocate its memory from alloc instead of
+// taking it from the ring-buffer pool, it should be called before the RingBuffer is used.
+func (b *RingBuffer) SetAllocator(alloc allocator.BufferAllocator) {
+	b.alloc = alloc
 }
 
 func (b *RingBuffer) instance() *ring.Buffer {
 	if b.rb == nil {
-		b.rb = rbPool.Get()
+		switch {
+		case b.spare != nil:
+			b.rb, b.spare = b.spare, nil
+		case b.alloc != nil:
+			b.rb = ring.NewWithAllocator(0, b.alloc)
+		default:
+			b.rb = rbPool.Get()
+		}
 	}
 
 	return b.rb
@@ -37,16 +53,26 @@ func (b *RingBuffer) instance() *ring.Buffer {
 // Done checks and returns the internal ring-buffer to pool.
 func (b *RingBuffer) Done() {
 	if b.rb != nil {
-		rbPool.Put(b.rb)
-		b.rb = nil
+		b.put()
 	}
+	b.spare = nil
 }
 
 func (b *RingBuffer) done() {
 	if b.rb != nil && b.rb.IsEmpty() {
+		b.put()
+	}
+}
+
+// put returns the internal ring-buffer to pool, or gives its memory back to the allocator.
+func (b *RingBuffer) put() {
+	if b.alloc != nil {
+		b.rb.Release()
+		b.spare = b.rb
+	} else {
 		rbPool.Put(b.rb)
-		b.rb = nil
 	}
+	b.rb = nil
 }
 
 // Peek returns the next n bytes without advancing the read pointer,
@@ -18,6 +18,7 @@ import (
 	"io"
 	"math"
 
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 	"github.com/panjf2000/gnet/v2/pkg/buffer/linkedlist"
 	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
 )
@@ -40,6 +41,13 @@ func New(maxStaticBytes int) (*Buffer, error) {
 	return &Buffer{maxStaticBytes: maxStaticBytes}, nil
 }
 
+// SetAllocator sets the allocator for the memory of both ring-buffer and list-buffer,
+// it should be called before the Buffer is used.
+func (mb *Buffer) SetAllocator(alloc allocator.BufferAllocator) {
+	mb.ringBuffer.SetAllocator(alloc)
+	mb.listBuffer.SetAllocator(alloc)
+}
+
 // Read reads data from the Buffer.
 func (mb *Buffer) Read(p []byte) (n int, err error) {
 	n, err = mb.ringBuffer.Read(p)
@@ -18,11 +18,13 @@ import (
 	"io"
 	"math"
 
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
 )
 
 type node struct {
-	buf  []byte
+	buf  []byte // unread bytes of mem
+	mem  []byte // byte slice allocated for this node
 	next *node
 }
 
@@ -37,6 +39,32 @@ type Buffer struct {
 	tail  *node
 	size  int
 	bytes int
+	alloc allocator.BufferAllocator
+}
+
+// SetAllocator sets the allocator of the byte slices for the nodes pushed afterward,
+// it should be called before the Buffer is used.
+func (llb *Buffer) SetAllocator(alloc allocator.BufferAllocator) {
+	llb.alloc = alloc
+}
+
+func (llb *Buffer) newNode(size int) *node {
+	var b []byte
+	if llb.alloc == nil {
+		b = bsPool.Get(size)
+	} else {
+		b = llb.alloc.Alloc(size)
+	}
+	return &node{buf: b, mem: b}
+}
+
+func (llb *Buffer) freeNode(b *node) {
+	if llb.alloc == nil {
+		bsPool.Put(b.mem)
+	} else {
+		llb.alloc.Free(b.mem)
+	}
+	b.buf, b.mem = nil, nil
 }
 
 // Read reads data from the Buffer.
@@ -52,7 +80,7 @@ func (llb *Buffer) Read(p []byte) (n int, err error) {
 			b.buf = b.buf[m:]
 			llb.pushFront(b)
 		} else {
-			bsPool.Put(b.buf)
+			llb.freeNode(b)
 		}
 		if n == len(p) {
 			return
@@ -67,9 +95,9 @@ func (llb *Buffer) PushFront(p []byte) {
 	if n == 0 {
 		return
 	}
-	b := bsPool.Get(n)
-	copy(b, p)
-	llb.pushFront(&node{buf: b})
+	b := llb.newNode(n)
+	copy(b.buf, p)
+	llb.pushFront(b)
 }
 
 // PushBack is a wrapper of pushBack, which accepts []byte as its argument.
@@ -78,9 +106,9 @@ func (llb *Buffer) PushBack(p []byte) {
 	if n == 0 {
 		return
 	}
-	b := bsPool.Get(n)
-	copy(b, p)
-	llb.pushBack(&node{buf: b})
+	b := llb.newNode(n)
+	copy(b.buf, p)
+	llb.pushBack(b)
 }
 
 // Peek assembles the up to maxBytes of [][]byte based on the list of node,
@@ -142,7 +170,7 @@ func (llb *Buffer) Discard(n int) (discarded int, err error) {
 		}
 		n -= b.len()
 		discarded += b.len()
-		bsPool.Put(b.buf)
+		llb.freeNode(b)
 	}
 	return
 }
@@ -153,22 +181,22 @@ const minRead = 512
 func (llb *Buffer) ReadFrom(r io.Reader) (n int64, err error) {
 	var m int
 	for {
-		b := bsPool.Get(minRead)
-		m, err = r.Read(b)
+		b := llb.newNode(minRead)
+		m, err = r.Read(b.buf)
 		if m < 0 {
 			panic("Buffer.ReadFrom: reader returned negative count from Read")
 		}
 		n += int64(m)
-		b = b[:m]
+		b.buf = b.buf[:m]
 		if err == io.EOF {
-			bsPool.Put(b)
+			llb.freeNode(b)
 			return n, nil
 		}
 		if err != nil {
-			bsPool.Put(b)
+			llb.freeNode(b)
 			return
 		}
-		llb.pushBack(&node{buf: b})
+		llb.pushBack(b)
 	}
 }
 
@@ -189,7 +217,7 @@ func (llb *Buffer) WriteTo(w io.Writer) (n int64, err error) {
 			llb.pushFront(b)
 			return n, io.ErrShortWrite
 		}
-		bsPool.Put(b.buf)
+		llb.freeNode(b)
 	}
 	return
 }
@@ -212,7 +240,7 @@ func (llb *Buffer) IsEmpty() bool {
 // Reset removes all elements from this list.
 func (llb *Buffer) Reset() {
 	for b := llb.pop(); b != nil; b = llb.pop() {
-		bsPool.Put(b.buf)
+		llb.freeNode(b)
 	}
 	llb.head = nil
 	llb.tail = nil
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 )
 
 func TestLinkedListBuffer_Basic(t *testing.T) {
@@ -147,3 +149,38 @@ func TestLinkedListBuffer_WriteTo(t *testing.T) {
 	buf.Reset()
 	newBuf.Reset()
 }
+
+func TestLinkedListBuffer_WithAllocator(t *testing.T) {
+	slab := allocator.NewSlab(0, 0, 0)
+	var llb Buffer
+	llb.SetAllocator(slab)
+
+	data := make([]byte, 1000)
+	rand.Read(data)
+	llb.PushBack(data)
+	llb.PushFront(data[:100])
+	n, err := llb.ReadFrom(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), n)
+	require.EqualValues(t, 1024+128+2*512, slab.Stats().InUse)
+
+	// The nodes partially consumed are freed in full.
+	buf := make([]byte, 150)
+	m, err := llb.Read(buf)
+	require.NoError(t, err)
+	require.EqualValues(t, 150, m)
+	require.EqualValues(t, 1024+2*512, slab.Stats().InUse)
+	discarded, err := llb.Discard(1000)
+	require.NoError(t, err)
+	require.EqualValues(t, 1000, discarded)
+	require.EqualValues(t, 2*512, slab.Stats().InUse)
+	w := bytes.NewBuffer(nil)
+	written, err := llb.WriteTo(w)
+	require.NoError(t, err)
+	require.EqualValues(t, 950, written)
+	require.Zero(t, slab.Stats().InUse)
+
+	llb.PushBack(data)
+	llb.Reset()
+	require.Zero(t, slab.Stats().InUse)
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/panjf2000/gnet/v2/internal/bs"
 	"github.com/panjf2000/gnet/v2/internal/math"
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
 )
 
@@ -40,6 +41,11 @@ const (
 	bufferGrowThreshold = 4 * 1024 // 4KB
 )
 
+// bufPool provides the memory of ring-buffers without an allocator, it's separated from the
+// built-in pool of byte slices, whose byte slices are tracked by the leak detector, because the
+// memory is owned by the ring-buffers, which are tracked by the ring-buffer pool instead.
+var bufPool bsPool.Pool
+
 // ErrIsEmpty will be returned when trying to read an empty ring-buffer.
 var ErrIsEmpty = errors.New("ring-buffer is empty")
 
@@ -51,6 +57,7 @@ type Buffer struct {
 	r       int // next position to read
 	w       int // next position to write
 	isEmpty bool
+	alloc   allocator.BufferAllocator
 }
 
 // New returns a new Buffer whose buffer has the given size.
@@ -67,6 +74,17 @@ func New(size int) *Buffer {
 	}
 }
 
+// NewWithAllocator returns a new Buffer whose buffer has the given size and is allocated from alloc,
+// the buffer is given back to alloc when it grows or Release is called.
+func NewWithAllocator(size int, alloc allocator.BufferAllocator) *Buffer {
+	rb := &Buffer{bs: make([][]byte, 2), isEmpty: true, alloc: alloc}
+	if size > 0 {
+		rb.size = math.CeilToPowerOfTwo(size)
+		rb.buf = rb.allocBytes(rb.size)
+	}
+	return rb
+}
+
 // Peek returns the next n bytes without advancing the read pointer,
 // it returns all bytes when n <= 0.
 func (rb *Buffer) Peek(n int) (head []byte, tail []byte) {
@@ -485,6 +503,33 @@ func (rb *Buffer) Reset() {
 	rb.r, rb.w = 0, 0
 }
 
+// Release gives the underlying buffer back to its allocator and empties the ring-buffer,
+// the ring-buffer remains usable and allocates a new buffer on the next write.
+func (rb *Buffer) Release() {
+	rb.freeBytes(rb.buf)
+	rb.buf = nil
+	rb.size = 0
+	rb.Reset()
+}
+
+func (rb *Buffer) allocBytes(size int) []byte {
+	if rb.alloc == nil {
+		return bufPool.Get(size)
+	}
+	return rb.alloc.Alloc(size)
+}
+
+func (rb *Buffer) freeBytes(buf []byte) {
+	if cap(buf) == 0 {
+		return
+	}
+	if rb.alloc == nil {
+		bufPool.Put(buf)
+		return
+	}
+	rb.alloc.Free(buf)
+}
+
 func (rb *Buffer) grow(newCap int) {
 	if n := rb.size; n == 0 {
 		if newCap <= DefaultBufferSize {
@@ -509,10 +554,10 @@ func (rb *Buffer) grow(newCap int) {
 			}
 		}
 	}
-	newBuf := bsPool.Get(newCap)
+	newBuf := rb.allocBytes(newCap)
 	oldLen := rb.Buffered()
 	_, _ = rb.Read(newBuf)
-	bsPool.Put(rb.buf)
+	rb.freeBytes(rb.buf)
 	rb.buf = newBuf
 	rb.r = 0
 	rb.w = oldLen
@@ -9,6 +9,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2/pkg/buffer/allocator"
 )
 
 func TestRingBuffer_Write(t *testing.T) {
@@ -430,3 +432,40 @@ func TestRingBuffer_WriteTo(t *testing.T) {
 	require.EqualValues(t, append(data[partLen:], partData...), buf.Bytes())
 	require.True(t, rb.IsEmpty())
 }
+
+func TestRingBufferWithAllocator(t *testing.T) {
+	slab := allocator.NewSlab(0, 0, 0)
+	rb := NewWithAllocator(100, slab)
+	assert.EqualValues(t, 128, rb.Cap())
+	assert.EqualValues(t, 128, slab.Stats().InUse)
+
+	data := make([]byte, 3*bufferGrowThreshold)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	for i := 0; i < len(data); i += 1000 {
+		end := i + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		n, err := rb.Write(data[i:end])
+		require.NoError(t, err)
+		require.EqualValues(t, end-i, n)
+	}
+	assert.EqualValues(t, data, rb.Bytes())
+	// Only the current buffer is held after growing several times.
+	assert.EqualValues(t, 16*1024, slab.Stats().InUse)
+
+	rb.Release()
+	assert.Zero(t, slab.Stats().InUse)
+	assert.True(t, rb.IsEmpty())
+	assert.Zero(t, rb.Cap())
+
+	// The ring-buffer is still usable after Release.
+	n, err := rb.Write(data[:10])
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, n)
+	assert.EqualValues(t, DefaultBufferSize, slab.Stats().InUse)
+	assert.EqualValues(t, data[:10], rb.Bytes())
+	rb.Release()
+	assert.Zero(t, slab.Stats().InUse)
+}
@@ -28,13 +28,13 @@ var (
 	// ErrTooManyEventLoopThreads occurs when attempting to set up more than 10,000 event-loop goroutines under LockOSThread mode.
 	ErrTooManyEventLoopThreads = errors.New("too many event-loops under LockOSThread mode")
 	// ErrUnsupportedProtocol occurs when trying to use protocol that is not supported.
-	ErrUnsupportedProtocol = errors.New("only unix, tcp/tcp4/tcp6, udp/udp4/udp6 are supported")
+	ErrUnsupportedProtocol = errors.New("only unix/unixgram/unixpacket, tcp/tcp4/tcp6, udp/udp4/udp6 are supported")
 	// ErrUnsupportedTCPProtocol occurs when trying to use an unsupported TCP protocol.
 	ErrUnsupportedTCPProtocol = errors.New("only tcp/tcp4/tcp6 are supported")
 	// ErrUnsupportedUDPProtocol occurs when trying to use an unsupported UDP protocol.
 	ErrUnsupportedUDPProtocol = errors.New("only udp/udp4/udp6 are supported")
 	// ErrUnsupportedUDSProtocol occurs when trying to use an unsupported Unix protocol.
-	ErrUnsupportedUDSProtocol = errors.New("only unix is supported")
+	ErrUnsupportedUDSProtocol = errors.New("only unix/unixgram/unixpacket are supported")
 	// ErrUnsupportedPlatform occurs when running gnet on an unsupported platform.
 	ErrUnsupportedPlatform = errors.New("unsupported platform in gnet")
 	// ErrUnsupportedOp occurs when calling some methods that has not been implemented yet.
@@ -43,4 +43,42 @@ var (
 	ErrNegativeSize = errors.New("negative size is invalid")
 	// ErrNoIPv4AddressOnInterface occurs when an IPv4 multicast address is set on an interface but IPv4 is not configured.
 	ErrNoIPv4AddressOnInterface = errors.New("no IPv4 address on interface")
+	// ErrInvalidLoopIndex occurs when the index of event-loop is out of range.
+	ErrInvalidLoopIndex = errors.New("invalid event-loop index")
+	// ErrInvalidFDEvents occurs when a user file descriptor is registered without readable or writable events.
+	ErrInvalidFDEvents = errors.New("user file descriptor must be registered with readable and/or writable events")
+	// ErrFDRegistered occurs when registering a user file descriptor that has been registered.
+	ErrFDRegistered = errors.New("user file descriptor is already registered")
+	// ErrFDUnregistered occurs when operating on a user file descriptor that has been unregistered.
+	ErrFDUnregistered = errors.New("user file descriptor is unregistered")
+	// ErrNoProxyHeader occurs when the data from peer doesn't start with a PROXY protocol header.
+	ErrNoProxyHeader = errors.New("no PROXY protocol header")
+	// ErrIncompleteProxyHeader occurs when there is not enough data to parse a PROXY protocol header.
+	ErrIncompleteProxyHeader = errors.New("incomplete PROXY protocol header")
+	// ErrInvalidProxyHeader occurs when the PROXY protocol header is malformed.
+	ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+	// ErrProxyHeaderTimeout occurs when the PROXY protocol header is not received in time.
+	ErrProxyHeaderTimeout = errors.New("timeout waiting for PROXY protocol header")
+	// ErrNoDataWithFDs occurs when sending file descriptors without any data, which must be sent along with at least one byte.
+	ErrNoDataWithFDs = errors.New("file descriptors must be sent along with at least one byte")
+	// ErrPendingOutbound occurs when sending file descriptors while the outbound buffer can't be flushed.
+	ErrPendingOutbound = errors.New("file descriptors can't be sent until the outbound buffer is flushed")
+
+	// The following errors are passed to EventHandler.OnClose as the reasons of closing connections,
+	// the error passed to OnClose may wrap the underlying error, use errors.Is to check the reason.
+
+	// ErrPeerClosed occurs when the peer shuts down the connection gracefully.
+	ErrPeerClosed = errors.New("connection closed by peer")
+	// ErrPeerReset occurs when the connection is reset by peer.
+	ErrPeerReset = errors.New("connection reset by peer")
+	// ErrLocalClosed occurs when the connection is closed by Conn.Close or Conn.CloseWithCallback.
+	ErrLocalClosed = errors.New("connection closed locally")
+	// ErrHandlerClosed occurs when the connection is closed as the event handler returns Close.
+	ErrHandlerClosed = errors.New("connection closed by event handler")
+	// ErrWriteFailed occurs when the connection is closed due to a failure of writing data to peer, it's not used on Windows.
+	ErrWriteFailed = errors.New("failed to write data to peer")
+	// ErrMemoryLimitExceeded occurs when the bytes held in the buffers of connections exceed the memory limit of engine.
+	ErrMemoryLimitExceeded = errors.New("memory limit of engine is exceeded")
+	// ErrBufferLeaked occurs when there are pooled buffers that have not been returned.
+	ErrBufferLeaked = errors.New("pooled buffers are leaked")
 )
@@ -21,9 +21,14 @@ import (
 	"runtime"
 	"sync"
 	"unsafe"
+
+	"github.com/panjf2000/gnet/v2/internal/leakcheck"
 )
 
-var builtinPool Pool
+var (
+	builtinPool Pool
+	tracker     = leakcheck.Register(&leakcheck.Tracker{Kind: "byteslice"})
+)
 
 // Pool consists of 32 sync.Pool, representing byte slices of length from 0 to 32 in powers of 2.
 type Pool struct {
@@ -31,12 +36,22 @@ type Pool struct {
 }
 
 // Get returns a byte slice with given length from the built-in pool.
+//
+// With the gnet_leakcheck tag, the byte slices taken from the built-in pool are tracked
+// until they're returned by Put.
 func Get(size int) []byte {
-	return builtinPool.Get(size)
+	buf := builtinPool.Get(size)
+	if leakcheck.Enabled && cap(buf) > 0 {
+		tracker.Track(uintptr(unsafe.Pointer(&buf[:1][0])), cap(buf), 1)
+	}
+	return buf
 }
 
 // Put returns the byte slice to the built-in pool.
 func Put(buf []byte) {
+	if leakcheck.Enabled && cap(buf) > 0 {
+		tracker.Untrack(uintptr(unsafe.Pointer(&buf[:1][0])))
+	}
 	builtinPool.Put(buf)
 }
 
@@ -23,7 +23,9 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"unsafe"
 
+	"github.com/panjf2000/gnet/v2/internal/leakcheck"
 	"github.com/panjf2000/gnet/v2/pkg/buffer/ring"
 )
 
@@ -55,14 +57,26 @@ type Pool struct {
 	pool sync.Pool
 }
 
-var builtinPool Pool
+var (
+	builtinPool Pool
+	tracker     = leakcheck.Register(&leakcheck.Tracker{Kind: "ringbuffer"})
+)
 
 // Get returns an empty byte buffer from the pool.
 //
 // Got byte buffer may be returned to the pool via Put call.
 // This reduces the number of memory allocations required for byte buffer
 // management.
-func Get() *RingBuffer { return builtinPool.Get() }
+//
+// With the gnet_leakcheck tag, the byte buffers taken from the pool are tracked until
+// they're returned by Put.
+func Get() *RingBuffer {
+	b := builtinPool.Get()
+	if leakcheck.Enabled {
+		tracker.Track(uintptr(unsafe.Pointer(b)), b.Cap(), 1)
+	}
+	return b
+}
 
 // Get returns new byte buffer with zero length.
 //
@@ -80,7 +94,12 @@ func (p *Pool) Get() *RingBuffer {
 //
 // RingBuffer mustn't be touched after returning it to the pool,
 // otherwise, data races will occur.
-func Put(b *RingBuffer) { builtinPool.Put(b) }
+func Put(b *RingBuffer) {
+	if leakcheck.Enabled {
+		tracker.Untrack(uintptr(unsafe.Pointer(b)))
+	}
+	builtinPool.Put(b)
+}
 
 // Put releases byte buffer obtained via Get to the pool.
 //
@@ -0,0 +1,288 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proxyproto implements the parser of HAProxy PROXY protocol headers, both the
+// human-readable version 1 and the binary version 2 are supported.
+//
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt for the specification.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// Command is the command of a PROXY protocol header.
+type Command byte
+
+const (
+	// Local indicates that the connection was established on purpose by the proxy
+	// without being relayed, the addresses in header should be ignored.
+	Local Command = 0x0
+	// Proxy indicates that the connection was established on behalf of another node.
+	Proxy Command = 0x1
+)
+
+// TLVType is the type of TLV (Type-Length-Value) vector in a version 2 header.
+type TLVType byte
+
+// Types of TLV defined by the specification.
+const (
+	TypeALPN      TLVType = 0x01
+	TypeAuthority TLVType = 0x02
+	TypeCRC32C    TLVType = 0x03
+	TypeNoop      TLVType = 0x04
+	TypeUniqueID  TLVType = 0x05
+	TypeSSL       TLVType = 0x20
+	TypeNetNS     TLVType = 0x30
+)
+
+// TLV is a Type-Length-Value vector carried by a version 2 header.
+type TLV struct {
+	Type  TLVType
+	Value []byte
+}
+
+// Header is a parsed PROXY protocol header.
+type Header struct {
+	// Version is the version of PROXY protocol, either 1 or 2.
+	Version int
+	// Command is the command of header, it's always Proxy for version 1.
+	Command Command
+	// SourceAddr is the address of the original client, it's nil if the addresses
+	// are unknown or not relayed.
+	SourceAddr net.Addr
+	// DestinationAddr is the address that the original client connected to, it's nil
+	// if the addresses are unknown or not relayed.
+	DestinationAddr net.Addr
+	// TLVs is the list of TLV vectors, it's always empty for version 1.
+	TLVs []TLV
+}
+
+// TLV returns the value of the first TLV vector of the given type.
+func (h *Header) TLV(typ TLVType) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	v1MaxLen       = 107 // the maximum length of a version 1 header including CRLF
+	v2HeaderLen    = 16  // the length of signature, version/command, family/protocol and length
+	v2AddrLenInet  = 12
+	v2AddrLenInet6 = 36
+	v2AddrLenUnix  = 216
+)
+
+// Parse parses a PROXY protocol header at the beginning of buf, it returns the header
+// and the number of bytes that the header occupies.
+//
+// Parse returns errors.ErrIncompleteProxyHeader if buf is a prefix of a valid header that
+// needs more data, errors.ErrNoProxyHeader if buf doesn't start with a PROXY protocol
+// signature, and errors.ErrInvalidProxyHeader if the header is malformed.
+//
+// The returned header doesn't retain buf.
+func Parse(buf []byte) (*Header, int, error) {
+	switch {
+	case hasPrefix(buf, v2Signature):
+		if len(buf) < len(v2Signature) {
+			return nil, 0, errors.ErrIncompleteProxyHeader
+		}
+		return parseV2(buf)
+	case hasPrefix(buf, v1Signature):
+		if len(buf) < len(v1Signature) {
+			return nil, 0, errors.ErrIncompleteProxyHeader
+		}
+		return parseV1(buf)
+	default:
+		return nil, 0, errors.ErrNoProxyHeader
+	}
+}
+
+// hasPrefix reports whether buf begins with sig, or buf is a non-empty prefix of sig.
+func hasPrefix(buf, sig []byte) bool {
+	if len(buf) == 0 {
+		return false
+	}
+	if len(buf) < len(sig) {
+		return bytes.Equal(buf, sig[:len(buf)])
+	}
+	return bytes.Equal(buf[:len(sig)], sig)
+}
+
+func parseV1(buf []byte) (*Header, int, error) {
+	end := bytes.Index(buf, []byte("\r\n"))
+	if end < 0 {
+		if len(buf) >= v1MaxLen {
+			return nil, 0, errors.ErrInvalidProxyHeader
+		}
+		return nil, 0, errors.ErrIncompleteProxyHeader
+	}
+	if end+2 > v1MaxLen {
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+
+	hdr := &Header{Version: 1, Command: Proxy}
+	fields := strings.Split(string(buf[len(v1Signature):end]), " ")
+	switch fields[0] {
+	case "UNKNOWN":
+		// The receiver must ignore anything presented after UNKNOWN.
+		return hdr, end + 2, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+	if len(fields) != 5 {
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[1]), net.ParseIP(fields[2])
+	if srcIP == nil || dstIP == nil {
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+	// The family is told by the textual form, as an IPv4-mapped IPv6 address is valid for TCP6.
+	isIPv6 := fields[0] == "TCP6"
+	if isIPv6 != strings.Contains(fields[1], ":") || isIPv6 != strings.Contains(fields[2], ":") {
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+	srcPort, err := parsePort(fields[3])
+	if err != nil {
+		return nil, 0, err
+	}
+	dstPort, err := parsePort(fields[4])
+	if err != nil {
+		return nil, 0, err
+	}
+	hdr.SourceAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	hdr.DestinationAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return hdr, end + 2, nil
+}
+
+func parsePort(s string) (int, error) {
+	// Leading zeros are not allowed by the specification.
+	if len(s) == 0 || (len(s) > 1 && s[0] == '0') {
+		return 0, errors.ErrInvalidProxyHeader
+	}
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, errors.ErrInvalidProxyHeader
+	}
+	return int(port), nil
+}
+
+func parseV2(buf []byte) (*Header, int, error) {
+	if len(buf) < v2HeaderLen {
+		return nil, 0, errors.ErrIncompleteProxyHeader
+	}
+	verCmd, famProto := buf[12], buf[13]
+	if verCmd>>4 != 2 {
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+	hdr := &Header{Version: 2, Command: Command(verCmd & 0x0f)}
+	if hdr.Command != Local && hdr.Command != Proxy {
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+	n := v2HeaderLen + int(binary.BigEndian.Uint16(buf[14:16]))
+	if len(buf) < n {
+		return nil, 0, errors.ErrIncompleteProxyHeader
+	}
+	payload := buf[v2HeaderLen:n]
+
+	var addrLen int
+	switch famProto >> 4 {
+	case 0x0: // AF_UNSPEC
+	case 0x1: // AF_INET
+		addrLen = v2AddrLenInet
+	case 0x2: // AF_INET6
+		addrLen = v2AddrLenInet6
+	case 0x3: // AF_UNIX
+		addrLen = v2AddrLenUnix
+	default:
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+	if len(payload) < addrLen {
+		return nil, 0, errors.ErrInvalidProxyHeader
+	}
+	// The addresses must be ignored for the LOCAL command and unspecified protocols.
+	if hdr.Command == Proxy && addrLen > 0 {
+		switch famProto & 0x0f {
+		case 0x1: // STREAM
+			hdr.SourceAddr, hdr.DestinationAddr = parseV2Addrs(famProto>>4, payload, false)
+		case 0x2: // DGRAM
+			hdr.SourceAddr, hdr.DestinationAddr = parseV2Addrs(famProto>>4, payload, true)
+		}
+	}
+
+	tlvs := payload[addrLen:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, 0, errors.ErrInvalidProxyHeader
+		}
+		l := 3 + int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < l {
+			return nil, 0, errors.ErrInvalidProxyHeader
+		}
+		value := make([]byte, l-3)
+		copy(value, tlvs[3:l])
+		hdr.TLVs = append(hdr.TLVs, TLV{Type: TLVType(tlvs[0]), Value: value})
+		tlvs = tlvs[l:]
+	}
+	return hdr, n, nil
+}
+
+func parseV2Addrs(family byte, payload []byte, datagram bool) (src, dst net.Addr) {
+	if family == 0x3 {
+		network := "unix"
+		if datagram {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: unixPath(payload[:108]), Net: network},
+			&net.UnixAddr{Name: unixPath(payload[108:216]), Net: network}
+	}
+
+	ipLen := net.IPv4len
+	if family == 0x2 {
+		ipLen = net.IPv6len
+	}
+	srcIP := make(net.IP, ipLen)
+	dstIP := make(net.IP, ipLen)
+	copy(srcIP, payload[:ipLen])
+	copy(dstIP, payload[ipLen:2*ipLen])
+	srcPort := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+	if datagram {
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}
+}
+
+func unixPath(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
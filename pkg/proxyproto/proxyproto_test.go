@@ -0,0 +1,136 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+func TestParseV1(t *testing.T) {
+	raw := []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET / HTTP/1.1\r\n")
+	hdr, n, err := Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, len("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"), n)
+	assert.Equal(t, 1, hdr.Version)
+	assert.Equal(t, Proxy, hdr.Command)
+	assert.Equal(t, "192.168.0.1:56324", hdr.SourceAddr.String())
+	assert.Equal(t, "192.168.0.11:443", hdr.DestinationAddr.String())
+
+	hdr, _, err = Parse([]byte("PROXY TCP6 ::1 fe80::1 1 65535\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:1", hdr.SourceAddr.String())
+	assert.Equal(t, "[fe80::1]:65535", hdr.DestinationAddr.String())
+
+	hdr, _, err = Parse([]byte("PROXY TCP6 ::ffff:192.168.0.1 ::1 56324 443\r\n"))
+	require.NoError(t, err)
+	assert.True(t, hdr.SourceAddr.(*net.TCPAddr).IP.Equal(net.ParseIP("192.168.0.1")))
+	assert.Equal(t, "[::1]:443", hdr.DestinationAddr.String())
+
+	hdr, n, err = Parse([]byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 35, n)
+	assert.Nil(t, hdr.SourceAddr)
+
+	for _, s := range []string{"P", "PROXY", "PROXY TCP4 192.168.0.1"} {
+		_, _, err = Parse([]byte(s))
+		assert.ErrorIs(t, err, errors.ErrIncompleteProxyHeader, s)
+	}
+	for _, s := range []string{
+		"PROXY TCP4 ::1 ::1 1 2\r\n",
+		"PROXY TCP4 ::ffff:192.168.0.1 192.168.0.11 1 2\r\n",
+		"PROXY TCP6 192.168.0.1 ::1 1 2\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 056324 443\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 65536 443\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 1\r\n",
+		"PROXY UDP4 192.168.0.1 192.168.0.11 1 2\r\n",
+	} {
+		_, _, err = Parse([]byte(s))
+		assert.ErrorIs(t, err, errors.ErrInvalidProxyHeader, s)
+	}
+	_, _, err = Parse(append([]byte("PROXY "), make([]byte, v1MaxLen)...))
+	assert.ErrorIs(t, err, errors.ErrInvalidProxyHeader)
+
+	for _, s := range []string{"GET / HTTP/1.1\r\n", "PROXX", "\r\n\r\nX"} {
+		_, _, err = Parse([]byte(s))
+		assert.ErrorIs(t, err, errors.ErrNoProxyHeader, s)
+	}
+}
+
+func buildV2(cmd Command, famProto byte, addrs []byte, tlvs ...TLV) []byte {
+	buf := append([]byte{}, v2Signature...)
+	buf = append(buf, 0x20|byte(cmd), famProto, 0, 0)
+	buf = append(buf, addrs...)
+	for _, tlv := range tlvs {
+		buf = append(buf, byte(tlv.Type), 0, 0)
+		binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(len(tlv.Value)))
+		buf = append(buf, tlv.Value...)
+	}
+	binary.BigEndian.PutUint16(buf[14:16], uint16(len(buf)-v2HeaderLen))
+	return buf
+}
+
+func TestParseV2(t *testing.T) {
+	addrs := []byte{10, 0, 0, 1, 10, 0, 0, 2, 0x1f, 0x90, 0x01, 0xbb}
+	raw := buildV2(Proxy, 0x11, addrs,
+		TLV{Type: TypeALPN, Value: []byte("h2")},
+		TLV{Type: TypeAuthority, Value: []byte("example.com")})
+	hdr, n, err := Parse(append(raw, "payload"...))
+	require.NoError(t, err)
+	assert.Equal(t, len(raw), n)
+	assert.Equal(t, 2, hdr.Version)
+	assert.Equal(t, Proxy, hdr.Command)
+	assert.Equal(t, &net.TCPAddr{IP: net.IP{10, 0, 0, 1}, Port: 8080}, hdr.SourceAddr)
+	assert.Equal(t, &net.TCPAddr{IP: net.IP{10, 0, 0, 2}, Port: 443}, hdr.DestinationAddr)
+	alpn, ok := hdr.TLV(TypeALPN)
+	assert.True(t, ok)
+	assert.Equal(t, "h2", string(alpn))
+	authority, ok := hdr.TLV(TypeAuthority)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", string(authority))
+	_, ok = hdr.TLV(TypeSSL)
+	assert.False(t, ok)
+
+	// The header must be parsed incrementally.
+	for i := 1; i < len(raw); i++ {
+		_, _, err = Parse(raw[:i])
+		assert.ErrorIs(t, err, errors.ErrIncompleteProxyHeader, i)
+	}
+
+	ip6 := make([]byte, v2AddrLenInet6)
+	ip6[15], ip6[31], ip6[33], ip6[35] = 1, 2, 53, 54
+	hdr, _, err = Parse(buildV2(Proxy, 0x22, ip6))
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:53", hdr.SourceAddr.String())
+	assert.Equal(t, "[::2]:54", hdr.DestinationAddr.String())
+	assert.Equal(t, "udp", hdr.SourceAddr.Network())
+
+	unixAddrs := make([]byte, v2AddrLenUnix)
+	copy(unixAddrs, "/tmp/src.sock")
+	copy(unixAddrs[108:], "/tmp/dst.sock")
+	hdr, _, err = Parse(buildV2(Proxy, 0x31, unixAddrs))
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/src.sock", hdr.SourceAddr.String())
+	assert.Equal(t, "/tmp/dst.sock", hdr.DestinationAddr.String())
+
+	// Addresses are ignored for the LOCAL command.
+	hdr, _, err = Parse(buildV2(Local, 0x11, addrs))
+	require.NoError(t, err)
+	assert.Equal(t, Local, hdr.Command)
+	assert.Nil(t, hdr.SourceAddr)
+
+	raw = buildV2(Proxy, 0x11, addrs)
+	raw[12] = 0x11
+	_, _, err = Parse(raw)
+	assert.ErrorIs(t, err, errors.ErrInvalidProxyHeader)
+	_, _, err = Parse(buildV2(Proxy, 0x21, addrs))
+	assert.ErrorIs(t, err, errors.ErrInvalidProxyHeader)
+	raw = buildV2(Proxy, 0x11, addrs, TLV{Type: TypeNoop, Value: []byte("xx")})
+	binary.BigEndian.PutUint16(raw[len(raw)-4:], 3)
+	_, _, err = Parse(raw)
+	assert.ErrorIs(t, err, errors.ErrInvalidProxyHeader)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"time"
+
+	"github.com/panjf2000/gnet/v2/pkg/errors"
+	"github.com/panjf2000/gnet/v2/pkg/proxyproto"
+)
+
+// ProxyProtocolMode indicates whether the accepted stream connections start with a PROXY protocol header.
+type ProxyProtocolMode int
+
+const (
+	// ProxyProtocolDisabled doesn't look for the PROXY protocol header.
+	ProxyProtocolDisabled ProxyProtocolMode = iota
+
+	// ProxyProtocolOptional consumes the PROXY protocol header if there is one, connections
+	// without a header are served as they are.
+	//
+	// Note that OnOpen is deferred until the first bytes arrive or ProxyProtocolTimeout expires
+	// to tell whether there is a header, so the protocols in which the server speaks first
+	// stall for the timeout on the connections without a header, set a short ProxyProtocolTimeout
+	// (e.g. a few hundred milliseconds) when serving such protocols.
+	ProxyProtocolOptional
+
+	// ProxyProtocolRequired closes the connections that don't start with a valid PROXY protocol header.
+	ProxyProtocolRequired
+)
+
+// DefaultProxyProtocolTimeout is the default timeout of reading the PROXY protocol header.
+const DefaultProxyProtocolTimeout = 5 * time.Second
+
+// parseProxyHeader consumes the PROXY protocol header from the inbound data of c,
+// it reports whether c is done with the header, either the header has been consumed
+// or there is no header under ProxyProtocolOptional.
+func (c *conn) parseProxyHeader(mode ProxyProtocolMode) (bool, error) {
+	buf, _ := c.Peek(-1)
+	hdr, n, err := proxyproto.Parse(buf)
+	switch {
+	case err == nil:
+		_, _ = c.Discard(n)
+		c.proxyHeader = hdr
+		return true, nil
+	case err == errors.ErrIncompleteProxyHeader:
+		return false, nil
+	case err == errors.ErrNoProxyHeader && mode == ProxyProtocolOptional:
+		return true, nil
+	default:
+		return false, err
+	}
+}
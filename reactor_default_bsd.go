@@ -19,7 +19,6 @@
 package gnet
 
 import (
-	"io"
 	"runtime"
 
 	"github.com/panjf2000/gnet/v2/internal/netpoll"
@@ -51,6 +50,8 @@ func (el *eventloop) activateSubReactor() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling(func(fd int, filter int16, flags uint16) (err error) {
 		if c := el.connections.getConn(fd); c != nil {
 			switch {
@@ -58,17 +59,22 @@ func (el *eventloop) activateSubReactor() error {
 			case flags&netpoll.EVFlagsEOF != 0:
 				switch {
 				case filter == netpoll.EVFilterRead: // read the remaining data after the peer wrote and closed immediately
+					c.peerShutdown = true
 					err = el.read(c)
 				case filter == netpoll.EVFilterWrite && !c.outboundBuffer.IsEmpty():
 					err = el.write(c)
 				default:
-					err = el.close(c, io.EOF)
+					err = el.close(c, errPeerClosed)
 				}
 			case filter == netpoll.EVFilterRead:
 				err = el.read(c)
 			case filter == netpoll.EVFilterWrite && !c.outboundBuffer.IsEmpty():
 				err = el.write(c)
 			}
+			return
+		}
+		if u := el.getUserFD(fd); u != nil {
+			return u.handleEvents(fd, filter, flags)
 		}
 		return
 	})
@@ -80,6 +86,7 @@ func (el *eventloop) activateSubReactor() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
@@ -91,6 +98,8 @@ func (el *eventloop) run() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling(func(fd int, filter int16, flags uint16) (err error) {
 		if c := el.connections.getConn(fd); c != nil {
 			switch {
@@ -98,11 +107,12 @@ func (el *eventloop) run() error {
 			case flags&netpoll.EVFlagsEOF != 0:
 				switch {
 				case filter == netpoll.EVFilterRead: // read the remaining data after the peer wrote and closed immediately
+					c.peerShutdown = true
 					err = el.read(c)
 				case filter == netpoll.EVFilterWrite && !c.outboundBuffer.IsEmpty():
 					err = el.write(c)
 				default:
-					err = el.close(c, io.EOF)
+					err = el.close(c, errPeerClosed)
 				}
 			case filter == netpoll.EVFilterRead:
 				err = el.read(c)
@@ -111,6 +121,9 @@ func (el *eventloop) run() error {
 			}
 			return
 		}
+		if u := el.getUserFD(fd); u != nil {
+			return u.handleEvents(fd, filter, flags)
+		}
 		return el.accept(fd, filter, flags)
 	})
 	if err == errors.ErrEngineShutdown {
@@ -121,6 +134,7 @@ func (el *eventloop) run() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
@@ -20,6 +20,8 @@ package gnet
 import (
 	"runtime"
 
+	"golang.org/x/sys/unix"
+
 	"github.com/panjf2000/gnet/v2/internal/netpoll"
 	"github.com/panjf2000/gnet/v2/pkg/errors"
 )
@@ -49,6 +51,8 @@ func (el *eventloop) activateSubReactor() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling(func(fd int, ev uint32) error {
 		if c := el.connections.getConn(fd); c != nil {
 			// Don't change the ordering of processing EPOLLOUT | EPOLLRDHUP / EPOLLIN unless you're 100%
@@ -68,10 +72,14 @@ func (el *eventloop) activateSubReactor() error {
 				}
 			}
 			if ev&netpoll.InEvents != 0 {
+				c.peerShutdown = ev&unix.EPOLLRDHUP != 0
 				return el.read(c)
 			}
 			return nil
 		}
+		if u := el.getUserFD(fd); u != nil {
+			return u.handleEvents(fd, ev)
+		}
 		return nil
 	})
 
@@ -83,6 +91,7 @@ func (el *eventloop) activateSubReactor() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
@@ -94,6 +103,8 @@ func (el *eventloop) run() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling(func(fd int, ev uint32) error {
 		if c := el.connections.getConn(fd); c != nil {
 			// Don't change the ordering of processing EPOLLOUT | EPOLLRDHUP / EPOLLIN unless you're 100%
@@ -113,10 +124,14 @@ func (el *eventloop) run() error {
 				}
 			}
 			if ev&netpoll.InEvents != 0 {
+				c.peerShutdown = ev&unix.EPOLLRDHUP != 0
 				return el.read(c)
 			}
 			return nil
 		}
+		if u := el.getUserFD(fd); u != nil {
+			return u.handleEvents(fd, ev)
+		}
 		return el.accept(fd, ev)
 	})
 
@@ -128,6 +143,7 @@ func (el *eventloop) run() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
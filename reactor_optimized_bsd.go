@@ -49,6 +49,8 @@ func (el *eventloop) activateSubReactor() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling()
 	if err == errors.ErrEngineShutdown {
 		el.engine.opts.Logger.Debugf("event-loop(%d) is exiting in terms of the demand from user, %v", el.idx, err)
@@ -58,6 +60,7 @@ func (el *eventloop) activateSubReactor() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
@@ -69,6 +72,8 @@ func (el *eventloop) run() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling()
 	if err == errors.ErrEngineShutdown {
 		el.engine.opts.Logger.Debugf("event-loop(%d) is exiting in terms of the demand from user, %v", el.idx, err)
@@ -78,6 +83,7 @@ func (el *eventloop) run() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
@@ -48,6 +48,8 @@ func (el *eventloop) activateSubReactor() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling()
 	if err == errors.ErrEngineShutdown {
 		el.engine.opts.Logger.Debugf("event-loop(%d) is exiting in terms of the demand from user, %v", el.idx, err)
@@ -57,6 +59,7 @@ func (el *eventloop) activateSubReactor() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
@@ -68,6 +71,8 @@ func (el *eventloop) run() error {
 		defer runtime.UnlockOSThread()
 	}
 
+	el.onLoopStart()
+
 	err := el.poller.Polling()
 	if err == errors.ErrEngineShutdown {
 		el.engine.opts.Logger.Debugf("event-loop(%d) is exiting in terms of the demand from user, %v", el.idx, err)
@@ -77,6 +82,7 @@ func (el *eventloop) run() error {
 	}
 
 	el.closeConns()
+	el.onLoopStop()
 	el.engine.shutdown(err)
 
 	return err
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || dragonfly || netbsd || openbsd || darwin
+// +build linux freebsd dragonfly netbsd openbsd darwin
+
+package gnet
+
+import "sort"
+
+const (
+	// maxReadsPerEvent is the default maximum number of reads on a connection per readable event,
+	// which prevents a fast sender from starving other connections on the same event-loop.
+	maxReadsPerEvent = 16
+
+	minAdaptiveReadSize     = 64
+	initialAdaptiveReadSize = 2048
+
+	readSizeIndexIncrement = 4
+	readSizeIndexDecrement = 1
+)
+
+// readSizeTable holds the candidates of read size, which increase by 16 up to 512 and double after that.
+var readSizeTable = func() (table []int) {
+	for i := 16; i < 512; i += 16 {
+		table = append(table, i)
+	}
+	for i := 512; i > 0 && i <= 1<<30; i <<= 1 {
+		table = append(table, i)
+	}
+	return
+}()
+
+// readSizeIndex returns the index of the least read size that is not less than size.
+func readSizeIndex(size int) int {
+	idx := sort.SearchInts(readSizeTable, size)
+	if idx == len(readSizeTable) {
+		idx--
+	}
+	return idx
+}
+
+// readSizer adjusts the size of each read on a connection in terms of the recent reads,
+// it grows rapidly when the reads fill up the buffer and shrinks gradually when they don't,
+// like the AdaptiveRecvByteBufAllocator of Netty.
+type readSizer struct {
+	index       int  // index of the current read size in readSizeTable
+	minIndex    int  // index of the minimum read size
+	maxIndex    int  // index of the maximum read size
+	limit       int  // maximum read size, 0 means the adaptive sizing is disabled
+	decreaseNow bool // whether the last read was small enough to shrink the read size
+}
+
+func (rs *readSizer) init(limit int) {
+	rs.limit = limit
+	rs.minIndex = readSizeIndex(minAdaptiveReadSize)
+	rs.maxIndex = readSizeIndex(limit)
+	if rs.index = readSizeIndex(initialAdaptiveReadSize); rs.index > rs.maxIndex {
+		rs.index = rs.maxIndex
+	}
+}
+
+// size returns the number of bytes to read next time.
+func (rs *readSizer) size() int {
+	if size := readSizeTable[rs.index]; size < rs.limit {
+		return size
+	}
+	return rs.limit
+}
+
+// record adjusts the read size in terms of the number of bytes read last time.
+func (rs *readSizer) record(n int) {
+	if rs.limit == 0 {
+		return
+	}
+	lower := rs.index - readSizeIndexDecrement
+	if lower < 0 {
+		lower = 0
+	}
+	switch {
+	case n <= readSizeTable[lower]:
+		if rs.decreaseNow {
+			if rs.index = lower; rs.index < rs.minIndex {
+				rs.index = rs.minIndex
+			}
+			rs.decreaseNow = false
+		} else {
+			rs.decreaseNow = true
+		}
+	case n >= rs.size():
+		if rs.index += readSizeIndexIncrement; rs.index > rs.maxIndex {
+			rs.index = rs.maxIndex
+		}
+		rs.decreaseNow = false
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"sync/atomic"
+
+	bsPool "github.com/panjf2000/gnet/v2/pkg/pool/byteslice"
+)
+
+// RetainedBuffer is a reference-counted slice of inbound data returned by Conn.NextRetained.
+// Unlike the []byte returned by Conn.Next, it remains valid after OnTraffic returns until all
+// references to it are released, thus it can be handed off to other goroutines without copying.
+//
+// All methods of RetainedBuffer are goroutine-safe.
+type RetainedBuffer struct {
+	b   []byte
+	blk *retainedBlock
+}
+
+// Bytes returns the data held by the buffer, it must not be used after the buffer is released.
+func (rb *RetainedBuffer) Bytes() []byte {
+	return rb.b
+}
+
+// Len returns the number of bytes held by the buffer.
+func (rb *RetainedBuffer) Len() int {
+	return len(rb.b)
+}
+
+// Retain adds a reference to the buffer, each call of Retain must be paired with a call of Release.
+func (rb *RetainedBuffer) Retain() {
+	rb.blk.retain()
+}
+
+// Release drops a reference to the buffer, the underlying memory is returned to the pool
+// once all references are dropped.
+func (rb *RetainedBuffer) Release() {
+	rb.blk.release()
+}
+
+// retainedBlock is a pooled memory block shared by the RetainedBuffers sliced from it.
+type retainedBlock struct {
+	buf  []byte
+	refs int32
+}
+
+func newRetainedBlock(buf []byte) *retainedBlock {
+	return &retainedBlock{buf: buf, refs: 1}
+}
+
+func (blk *retainedBlock) retain() {
+	atomic.AddInt32(&blk.refs, 1)
+}
+
+func (blk *retainedBlock) release() {
+	switch refs := atomic.AddInt32(&blk.refs, -1); {
+	case refs == 0:
+		bsPool.Put(blk.buf)
+		blk.buf = nil
+	case refs < 0:
+		panic("gnet: RetainedBuffer is released more times than it's retained")
+	}
+}
+
+// retainCopy copies p into a RetainedBuffer from the pool.
+func retainCopy(p []byte) *RetainedBuffer {
+	blk := newRetainedBlock(bsPool.Get(len(p)))
+	copy(blk.buf, p)
+	return &RetainedBuffer{b: blk.buf, blk: blk}
+}
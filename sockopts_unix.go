@@ -0,0 +1,79 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || dragonfly || netbsd || openbsd || darwin
+// +build linux freebsd dragonfly netbsd openbsd darwin
+
+package gnet
+
+import (
+	"strings"
+	"time"
+
+	"github.com/panjf2000/gnet/v2/internal/socket"
+)
+
+// listenerSockOpts returns the socket options set on listeners in addition to the basic ones.
+func listenerSockOpts(network string, opts *Options) (sockOpts []socket.Option) {
+	if strings.HasPrefix(network, "tcp") {
+		if opts.TCPFastOpen > 0 {
+			sockOpts = append(sockOpts, socket.Option{SetSockOpt: socket.SetFastOpen, Opt: opts.TCPFastOpen})
+		}
+		if opts.TCPDeferAccept > 0 {
+			secs := int((opts.TCPDeferAccept + time.Second - 1) / time.Second)
+			sockOpts = append(sockOpts, socket.Option{SetSockOpt: socket.SetDeferAccept, Opt: secs})
+		}
+	}
+	if opts.SocketBusyPoll > 0 {
+		usecs := int(opts.SocketBusyPoll / time.Microsecond)
+		sockOpts = append(sockOpts, socket.Option{SetSockOpt: socket.SetBusyPoll, Opt: usecs})
+	}
+	for _, opt := range opts.SocketOptions {
+		level, name := opt.Level, opt.Name
+		sockOpts = append(sockOpts, socket.Option{
+			SetSockOpt: func(fd, value int) error { return socket.SetSockOptInt(fd, level, name, value) },
+			Opt:        opt.Value,
+		})
+	}
+	return
+}
+
+// setConnSockOpts sets the socket options on an accepted or dialed connection, a failed option
+// doesn't prevent the rest from being set, and the first error is returned.
+func setConnSockOpts(fd int, network string, opts *Options) (err error) {
+	keep := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	if strings.HasPrefix(network, "tcp") {
+		if opts.TCPKeepAlive > 0 {
+			keep(socket.SetKeepAlive(fd, int(opts.TCPKeepAlive/time.Second),
+				int(opts.TCPKeepAliveInterval/time.Second), opts.TCPKeepAliveCount))
+		}
+		if opts.TCPUserTimeout > 0 {
+			keep(socket.SetUserTimeout(fd, int(opts.TCPUserTimeout/time.Millisecond)))
+		}
+		if opts.TCPQuickAck {
+			keep(socket.SetQuickAck(fd, 1))
+		}
+	}
+	if opts.SocketBusyPoll > 0 {
+		keep(socket.SetBusyPoll(fd, int(opts.SocketBusyPoll/time.Microsecond)))
+	}
+	for _, opt := range opts.SocketOptions {
+		keep(socket.SetSockOptInt(fd, opt.Level, opt.Name, opt.Value))
+	}
+	return
+}
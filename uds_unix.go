@@ -0,0 +1,124 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || dragonfly || netbsd || openbsd || darwin
+// +build linux freebsd dragonfly netbsd openbsd darwin
+
+package gnet
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	errorx "github.com/panjf2000/gnet/v2/pkg/errors"
+	"github.com/panjf2000/gnet/v2/pkg/logging"
+)
+
+// maxRecvFDs is the maximum number of file descriptors that can be received along with one read.
+const maxRecvFDs = 64
+
+func (c *conn) isUnix() bool {
+	_, ok := c.peer.(*unix.SockaddrUnix)
+	return ok
+}
+
+// recvmsg reads data from a unix domain socket, collecting the file descriptors passed along with it.
+func (el *eventloop) recvmsg(c *conn, buf []byte) (int, error) {
+	if el.oob == nil {
+		el.oob = make([]byte, unix.CmsgSpace(maxRecvFDs*4))
+	}
+	n, oobn, flags, _, err := unix.Recvmsg(c.fd, buf, el.oob, recvmsgFlags)
+	if err != nil || oobn == 0 {
+		return n, err
+	}
+	if flags&unix.MSG_CTRUNC != 0 {
+		el.getLogger().Warnf("ancillary data from connection(fd=%d) is truncated, some file descriptors are discarded", c.fd)
+	}
+	msgs, err := unix.ParseSocketControlMessage(el.oob[:oobn])
+	if err != nil {
+		el.getLogger().Errorf("failed to parse ancillary data from connection(fd=%d): %v", c.fd, err)
+		return n, nil
+	}
+	for i := range msgs {
+		fds, err := unix.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		if recvmsgFlags == 0 {
+			for _, fd := range fds {
+				unix.CloseOnExec(fd)
+			}
+		}
+		c.fds = append(c.fds, fds...)
+	}
+	return n, nil
+}
+
+func (c *conn) closeFDs() {
+	for _, fd := range c.fds {
+		_ = unix.Close(fd)
+	}
+	c.fds = nil
+}
+
+func (c *conn) ReadFDs() (fds []int) {
+	fds, c.fds = c.fds, nil
+	return
+}
+
+func (c *conn) WriteWithFDs(p []byte, fds []int) (n int, err error) {
+	if len(fds) == 0 {
+		return c.Write(p)
+	}
+	if !c.isUnix() {
+		return 0, errorx.ErrUnsupportedUDSProtocol
+	}
+	if len(p) == 0 {
+		return 0, errorx.ErrNoDataWithFDs
+	}
+	if !c.outboundBuffer.IsEmpty() {
+		if err = c.loop.write(c); err != nil {
+			return
+		}
+		if !c.opened {
+			return 0, net.ErrClosed
+		}
+		if !c.outboundBuffer.IsEmpty() {
+			return 0, errorx.ErrPendingOutbound
+		}
+	}
+
+	n = len(p)
+	var sent int
+	if sent, err = unix.SendmsgN(c.fd, p, unix.UnixRights(fds...), nil, 0); err != nil {
+		// Unlike the plain data, the file descriptors can't be buffered, let the caller retry later.
+		if err == unix.EAGAIN {
+			return 0, os.NewSyscallError("sendmsg", err)
+		}
+		if err := c.loop.close(c, &closeError{errorx.ErrWriteFailed, os.NewSyscallError("sendmsg", err)}); err != nil {
+			logging.Errorf("failed to close connection(fd=%d,peer=%+v) on conn.WriteWithFDs: %v",
+				c.fd, c.remoteAddr, err)
+		}
+		return 0, os.NewSyscallError("sendmsg", err)
+	}
+	// The file descriptors have been sent along with the first byte, buffer the leftover data for the next round.
+	if sent < n {
+		_, _ = c.outboundBuffer.Write(p[sent:])
+		c.account()
+		err = c.pollWrite()
+	}
+	return
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+// FDEvent is a bit set of I/O events on a user file descriptor.
+type FDEvent uint8
+
+const (
+	// FDEventRead indicates that the file descriptor is readable.
+	FDEventRead FDEvent = 1 << iota
+
+	// FDEventWrite indicates that the file descriptor is writable.
+	FDEventWrite
+
+	// FDEventError indicates an error or hang-up condition on the file descriptor,
+	// it's always reported and doesn't need to be registered.
+	FDEventError
+)
+
+// FDHandler handles the I/O events on a user file descriptor, it's invoked on the goroutine
+// of the event-loop where the file descriptor is registered, thus it must not block.
+type FDHandler func(fd int, events FDEvent)
@@ -0,0 +1,79 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build freebsd || dragonfly || netbsd || openbsd || darwin
+// +build freebsd dragonfly netbsd openbsd darwin
+
+package gnet
+
+import (
+	"github.com/panjf2000/gnet/v2/internal/netpoll"
+)
+
+func (u *RegisteredFD) handleEvents(_ int, filter int16, flags uint16) error {
+	if flags&netpoll.EVFlagsDelete != 0 {
+		return nil
+	}
+	var events FDEvent
+	switch filter {
+	case netpoll.EVFilterRead:
+		events |= FDEventRead
+	case netpoll.EVFilterWrite:
+		events |= FDEventWrite
+	}
+	if flags&netpoll.EVFlagsEOF != 0 {
+		events |= FDEventError
+	}
+	u.fire(events)
+	return nil
+}
+
+// modify adds the filters that are newly registered before deleting the ones that are no longer needed,
+// ModRead and ModWrite of kqueue delete the writable and readable filter respectively.
+func (u *RegisteredFD) modify(events FDEvent) (err error) {
+	added, deleted := events&^u.events, u.events&^events
+	if added&FDEventRead != 0 {
+		if err = u.el.poller.AddRead(&u.pollAttachment); err != nil {
+			return
+		}
+	}
+	if added&FDEventWrite != 0 {
+		if err = u.el.poller.AddWrite(&u.pollAttachment); err != nil {
+			return
+		}
+	}
+	if deleted&FDEventRead != 0 {
+		if err = u.el.poller.ModWrite(&u.pollAttachment); err != nil {
+			return
+		}
+	}
+	if deleted&FDEventWrite != 0 {
+		err = u.el.poller.ModRead(&u.pollAttachment)
+	}
+	return
+}
+
+// remove deletes all filters of the file descriptor as it's not closed by gnet,
+// the kqueue poller only gets rid of them when the file descriptor is closed.
+func (u *RegisteredFD) remove() (err error) {
+	if u.events&FDEventWrite != 0 {
+		err = u.el.poller.ModRead(&u.pollAttachment)
+	}
+	if u.events&FDEventRead != 0 {
+		if e := u.el.poller.ModWrite(&u.pollAttachment); err == nil {
+			err = e
+		}
+	}
+	return
+}
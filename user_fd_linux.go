@@ -0,0 +1,51 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/panjf2000/gnet/v2/internal/netpoll"
+)
+
+func (u *RegisteredFD) handleEvents(_ int, ev uint32) error {
+	var events FDEvent
+	if ev&(unix.EPOLLIN|unix.EPOLLPRI) != 0 {
+		events |= FDEventRead
+	}
+	if ev&unix.EPOLLOUT != 0 {
+		events |= FDEventWrite
+	}
+	if ev&netpoll.ErrEvents != 0 {
+		events |= FDEventError
+	}
+	u.fire(events)
+	return nil
+}
+
+func (u *RegisteredFD) modify(events FDEvent) error {
+	switch events {
+	case FDEventRead:
+		return u.el.poller.ModRead(&u.pollAttachment)
+	case FDEventWrite:
+		return u.el.poller.ModWrite(&u.pollAttachment)
+	default:
+		return u.el.poller.ModReadWrite(&u.pollAttachment)
+	}
+}
+
+func (u *RegisteredFD) remove() error {
+	return u.el.poller.Delete(u.pollAttachment.FD)
+}
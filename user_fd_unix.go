@@ -0,0 +1,143 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || dragonfly || netbsd || openbsd || darwin
+// +build linux freebsd dragonfly netbsd openbsd darwin
+
+package gnet
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/panjf2000/gnet/v2/internal/netpoll"
+	"github.com/panjf2000/gnet/v2/pkg/errors"
+)
+
+// RegisteredFD is a user file descriptor registered on an event-loop, see Engine.RegisterFD.
+type RegisteredFD struct {
+	mu             sync.Mutex
+	el             *eventloop
+	events         FDEvent
+	handler        FDHandler
+	pollAttachment netpoll.PollAttachment
+	registered     int32
+}
+
+// RegisterFD registers a user file descriptor, e.g. timerfd, eventfd, signalfd, inotify or pipe,
+// on the event-loop of the given index, handler is invoked on the goroutine of that event-loop
+// when any of the given events occurs. The file descriptor should be in non-blocking mode
+// and it's still owned by the caller, gnet never reads from, writes to or closes it.
+//
+// The event-loops are available once the engine has booted, thus it can't be called in OnBoot.
+func (e Engine) RegisterFD(loopIdx, fd int, events FDEvent, handler FDHandler) (*RegisteredFD, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	if events&(FDEventRead|FDEventWrite) == 0 || handler == nil {
+		return nil, errors.ErrInvalidFDEvents
+	}
+	if e.eng.eventLoops == nil || loopIdx < 0 || loopIdx >= e.eng.eventLoops.len() {
+		return nil, errors.ErrInvalidLoopIndex
+	}
+
+	el := e.eng.eventLoops.index(loopIdx)
+	u := &RegisteredFD{
+		el:             el,
+		events:         events & (FDEventRead | FDEventWrite),
+		handler:        handler,
+		pollAttachment: netpoll.PollAttachment{FD: fd},
+		registered:     1,
+	}
+	u.pollAttachment.Callback = u.handleEvents
+	if _, loaded := el.userFDs.LoadOrStore(fd, u); loaded {
+		return nil, errors.ErrFDRegistered
+	}
+
+	var err error
+	switch u.events {
+	case FDEventRead:
+		err = el.poller.AddRead(&u.pollAttachment)
+	case FDEventWrite:
+		err = el.poller.AddWrite(&u.pollAttachment)
+	default:
+		err = el.poller.AddReadWrite(&u.pollAttachment)
+	}
+	if err != nil {
+		el.userFDs.Delete(fd)
+		return nil, err
+	}
+	return u, nil
+}
+
+// Fd returns the underlying file descriptor.
+func (u *RegisteredFD) Fd() int {
+	return u.pollAttachment.FD
+}
+
+// LoopIndex returns the index of event-loop where the file descriptor is registered.
+func (u *RegisteredFD) LoopIndex() int {
+	return u.el.idx
+}
+
+// Modify replaces the registered events of the file descriptor with the given ones.
+func (u *RegisteredFD) Modify(events FDEvent) error {
+	if events &= FDEventRead | FDEventWrite; events == 0 {
+		return errors.ErrInvalidFDEvents
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if atomic.LoadInt32(&u.registered) == 0 {
+		return errors.ErrFDUnregistered
+	}
+	if events == u.events {
+		return nil
+	}
+	if err := u.modify(events); err != nil {
+		return err
+	}
+	u.events = events
+	return nil
+}
+
+// Unregister removes the file descriptor from the event-loop, the handler won't be invoked
+// after it returns if it's called on the goroutine of the event-loop. The file descriptor
+// is not closed.
+func (u *RegisteredFD) Unregister() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&u.registered, 1, 0) {
+		return errors.ErrFDUnregistered
+	}
+	err := u.remove()
+	u.el.userFDs.Delete(u.pollAttachment.FD)
+	return err
+}
+
+func (u *RegisteredFD) fire(events FDEvent) {
+	if events != 0 && atomic.LoadInt32(&u.registered) == 1 {
+		u.handler(u.pollAttachment.FD, events)
+	}
+}
+
+// getUserFD returns the user file descriptor registered on this event-loop, or nil if there is none.
+func (el *eventloop) getUserFD(fd int) *RegisteredFD {
+	if v, ok := el.userFDs.Load(fd); ok {
+		return v.(*RegisteredFD)
+	}
+	return nil
+}
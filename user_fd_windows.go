@@ -0,0 +1,45 @@
+// Copyright (c) 2024 The Gnet Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gnet
+
+import "github.com/panjf2000/gnet/v2/pkg/errors"
+
+// RegisteredFD is a user file descriptor registered on an event-loop, see Engine.RegisterFD.
+type RegisteredFD struct{}
+
+// RegisterFD is not supported on Windows.
+func (e Engine) RegisterFD(_, _ int, _ FDEvent, _ FDHandler) (*RegisteredFD, error) {
+	return nil, errors.ErrUnsupportedOp
+}
+
+// Fd returns the underlying file descriptor.
+func (*RegisteredFD) Fd() int {
+	return -1
+}
+
+// LoopIndex returns the index of event-loop where the file descriptor is registered.
+func (*RegisteredFD) LoopIndex() int {
+	return -1
+}
+
+// Modify is not supported on Windows.
+func (*RegisteredFD) Modify(_ FDEvent) error {
+	return errors.ErrUnsupportedOp
+}
+
+// Unregister is not supported on Windows.
+func (*RegisteredFD) Unregister() error {
+	return errors.ErrUnsupportedOp
+}